@@ -0,0 +1,293 @@
+// Package bencode implements the encoding used by .torrent files,
+// as defined by the BitTorrent specification (BEP 3).
+//
+// Values are decoded to int64, string, []interface{} and
+// map[string]interface{}, strings holding arbitrary bytes.
+package bencode
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// maxDepth is the maximum nesting of lists and dictionaries.
+const maxDepth = 256
+
+// SyntaxError represents an invalid bencoded data.
+type SyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("bencode: %s at offset %d", e.Msg, e.Offset)
+}
+
+// RawMessage is a raw encoded value. It is written as is by Marshal
+// and keeps the exact bytes of a value decoded by UnmarshalDict.
+type RawMessage []byte
+
+type decoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func (d *decoder) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Offset: d.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Unmarshal decodes 'data', which must hold a single value.
+func Unmarshal(data []byte) (interface{}, error) {
+	d := &decoder{data: data}
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, d.errorf("trailing data")
+	}
+	return v, nil
+}
+
+// UnmarshalDict decodes 'data', which must hold a single dictionary,
+// keeping its values encoded.
+func UnmarshalDict(data []byte) (map[string]RawMessage, error) {
+	d := &decoder{data: data}
+	if d.pos >= len(d.data) || d.data[d.pos] != 'd' {
+		return nil, d.errorf("expected a dictionary")
+	}
+	d.pos++
+	dict := map[string]RawMessage{}
+	for {
+		if d.pos >= len(d.data) {
+			return nil, d.errorf("unexpected end of data")
+		}
+		if d.data[d.pos] == 'e' {
+			d.pos++
+			break
+		}
+		key, err := d.key(func(key string) bool {
+			_, ok := dict[key]
+			return ok
+		})
+		if err != nil {
+			return nil, err
+		}
+		start := d.pos
+		_, err = d.value()
+		if err != nil {
+			return nil, err
+		}
+		dict[key] = RawMessage(d.data[start:d.pos])
+	}
+	if d.pos != len(d.data) {
+		return nil, d.errorf("trailing data")
+	}
+	return dict, nil
+}
+
+func (d *decoder) value() (interface{}, error) {
+	if d.pos >= len(d.data) {
+		return nil, d.errorf("unexpected end of data")
+	}
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		return d.integer()
+	case c >= '0' && c <= '9':
+		return d.str()
+	case c == 'l':
+		return d.list()
+	case c == 'd':
+		return d.dict()
+	default:
+		return nil, d.errorf("invalid character %q", c)
+	}
+}
+
+func (d *decoder) integer() (int64, error) {
+	d.pos++
+	end := bytes.IndexByte(d.data[d.pos:], 'e')
+	if end < 0 {
+		return 0, d.errorf("unterminated integer")
+	}
+	s := string(d.data[d.pos : d.pos+end])
+	if len(s) == 0 || s == "-0" || (s[0] == '0' && len(s) > 1) || (len(s) > 1 && s[0] == '-' && s[1] == '0') {
+		return 0, d.errorf("invalid integer %q", s)
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, d.errorf("invalid integer %q", s)
+	}
+	d.pos += end + 1
+	return i, nil
+}
+
+func (d *decoder) str() (string, error) {
+	colon := bytes.IndexByte(d.data[d.pos:], ':')
+	if colon < 0 {
+		return "", d.errorf("unterminated string length")
+	}
+	s := string(d.data[d.pos : d.pos+colon])
+	length, err := strconv.Atoi(s)
+	if err != nil || length < 0 || (s[0] == '0' && len(s) > 1) {
+		return "", d.errorf("invalid string length %q", s)
+	}
+	start := d.pos + colon + 1
+	if length > len(d.data)-start {
+		return "", d.errorf("string of length %d exceeds data", length)
+	}
+	d.pos = start + length
+	return string(d.data[start:d.pos]), nil
+}
+
+func (d *decoder) enter() error {
+	d.depth++
+	if d.depth > maxDepth {
+		return d.errorf("exceeded max depth")
+	}
+	d.pos++
+	return nil
+}
+
+func (d *decoder) list() ([]interface{}, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	list := []interface{}{}
+	for {
+		if d.pos >= len(d.data) {
+			return nil, d.errorf("unexpected end of data")
+		}
+		if d.data[d.pos] == 'e' {
+			d.pos++
+			d.depth--
+			return list, nil
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+}
+
+// key decodes a dictionary key, which must not be a duplicated one.
+// Unsorted keys are accepted since some .torrent files have them.
+func (d *decoder) key(exists func(string) bool) (string, error) {
+	if c := d.data[d.pos]; c < '0' || c > '9' {
+		return "", d.errorf("dictionary key must be a string")
+	}
+	start := d.pos
+	key, err := d.str()
+	if err != nil {
+		return "", err
+	}
+	if exists(key) {
+		d.pos = start
+		return "", d.errorf("duplicated dictionary key %q", key)
+	}
+	return key, nil
+}
+
+func (d *decoder) dict() (map[string]interface{}, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	dict := map[string]interface{}{}
+	for {
+		if d.pos >= len(d.data) {
+			return nil, d.errorf("unexpected end of data")
+		}
+		if d.data[d.pos] == 'e' {
+			d.pos++
+			d.depth--
+			return dict, nil
+		}
+		key, err := d.key(func(key string) bool {
+			_, ok := dict[key]
+			return ok
+		})
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		dict[key] = v
+	}
+}
+
+// Marshal encodes 'v' which can be an integer, a string, a []byte, a RawMessage,
+// a []interface{}, a []string, a map[string]interface{} or a map[string]RawMessage.
+// Dictionary keys are sorted as required by the specification.
+func Marshal(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := encode(buf, v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encode(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case int:
+		fmt.Fprintf(buf, "i%de", v)
+	case int64:
+		fmt.Fprintf(buf, "i%de", v)
+	case string:
+		fmt.Fprintf(buf, "%d:%s", len(v), v)
+	case []byte:
+		fmt.Fprintf(buf, "%d:", len(v))
+		buf.Write(v)
+	case RawMessage:
+		buf.Write(v)
+	case []string:
+		buf.WriteByte('l')
+		for _, s := range v {
+			encode(buf, s)
+		}
+		buf.WriteByte('e')
+	case []interface{}:
+		buf.WriteByte('l')
+		for _, element := range v {
+			if err := encode(buf, element); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('d')
+		for _, key := range keys {
+			encode(buf, key)
+			if err := encode(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	case map[string]RawMessage:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('d')
+		for _, key := range keys {
+			encode(buf, key)
+			buf.Write(v[key])
+		}
+		buf.WriteByte('e')
+	default:
+		return fmt.Errorf("bencode: unsupported type %T", v)
+	}
+	return nil
+}
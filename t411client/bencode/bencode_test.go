@@ -0,0 +1,90 @@
+package bencode
+
+import (
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type MySuite struct{}
+
+var _ = Suite(&MySuite{})
+
+func (s *MySuite) TestUnmarshal(c *C) {
+	for data, expected := range map[string]interface{}{
+		"i42e":           int64(42),
+		"i-42e":          int64(-42),
+		"i0e":            int64(0),
+		"0:":             "",
+		"4:spam":         "spam",
+		"3:\x00\xff\n":   "\x00\xff\n",
+		"le":             []interface{}{},
+		"l4:spami42ee":   []interface{}{"spam", int64(42)},
+		"de":             map[string]interface{}{},
+		"d1:bi1e1:ai2ee": map[string]interface{}{"a": int64(2), "b": int64(1)},
+		"d4:listl1:ad1:xi1eeee": map[string]interface{}{
+			"list": []interface{}{"a", map[string]interface{}{"x": int64(1)}},
+		},
+	} {
+		v, err := Unmarshal([]byte(data))
+		c.Assert(err, IsNil, Commentf("data %q", data))
+		c.Assert(v, DeepEquals, expected, Commentf("data %q", data))
+	}
+	for data, msg := range map[string]string{
+		"":                       "bencode: unexpected end of data at offset 0",
+		"i42":                    "bencode: unterminated integer at offset 1",
+		"ie":                     `bencode: invalid integer "" at offset 1`,
+		"i-0e":                   `bencode: invalid integer "-0" at offset 1`,
+		"i042e":                  `bencode: invalid integer "042" at offset 1`,
+		"i99999999999999999999e": `bencode: invalid integer "99999999999999999999" at offset 1`,
+		"5:spam":                 "bencode: string of length 5 exceeds data at offset 0",
+		"-1:a":                   "bencode: invalid character '-' at offset 0",
+		"4spam":                  "bencode: unterminated string length at offset 0",
+		"l4:spam":                "bencode: unexpected end of data at offset 7",
+		"di1ei2ee":               "bencode: dictionary key must be a string at offset 1",
+		"d1:ai1e1:ai2ee":         `bencode: duplicated dictionary key "a" at offset 7`,
+		"i1ei2e":                 "bencode: trailing data at offset 3",
+		"<html>":                 "bencode: invalid character '<' at offset 0",
+		strings.Repeat("l", maxDepth+1) + strings.Repeat("e", maxDepth+1): "bencode: exceeded max depth at offset 256",
+	} {
+		_, err := Unmarshal([]byte(data))
+		c.Assert(err, FitsTypeOf, &SyntaxError{}, Commentf("data %q", data))
+		c.Assert(err.Error(), Equals, msg, Commentf("data %q", data))
+	}
+}
+
+func (s *MySuite) TestUnmarshalDict(c *C) {
+	dict, err := UnmarshalDict([]byte("d8:announce3:url4:infod6:lengthi1eee"))
+	c.Assert(err, IsNil)
+	c.Assert(dict, DeepEquals, map[string]RawMessage{
+		"announce": RawMessage("3:url"),
+		"info":     RawMessage("d6:lengthi1ee"),
+	})
+	for _, data := range []string{"", "le", "d1:ai1e", "d1:ai1eei1e"} {
+		_, err = UnmarshalDict([]byte(data))
+		c.Assert(err, FitsTypeOf, &SyntaxError{}, Commentf("data %q", data))
+	}
+}
+
+func (s *MySuite) TestMarshal(c *C) {
+	data, err := Marshal(map[string]interface{}{
+		"name":   "spam",
+		"length": 42,
+		"files":  []interface{}{int64(-1), []byte("\x00"), []string{"a", "b"}},
+		"info":   RawMessage("de"),
+		"raw":    map[string]RawMessage{"z": RawMessage("i1e"), "y": RawMessage("0:")},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "d5:filesli-1e1:\x00l1:a1:bee4:infode6:lengthi42e4:name4:spam3:rawd1:y0:1:zi1eee")
+	v, err := Unmarshal(data)
+	c.Assert(err, IsNil)
+	again, err := Marshal(v)
+	c.Assert(err, IsNil)
+	c.Assert(again, DeepEquals, data)
+
+	_, err = Marshal(map[string]interface{}{"float": 1.5})
+	c.Assert(err, ErrorMatches, "bencode: unsupported type float64")
+}
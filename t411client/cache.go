@@ -0,0 +1,184 @@
+package t411client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dns-gh/t411-client/t411client/internal/atomicfile"
+)
+
+// cacheEntry represents a cached API response.
+type cacheEntry struct {
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"lastModified,omitempty"`
+	Fetched      time.Time       `json:"fetched"`
+	Body         json.RawMessage `json:"body"`
+}
+
+// diskCache stores API responses as JSON files in a directory,
+// one per endpoint in a sub-directory per base url.
+type diskCache struct {
+	dir string
+	ttl time.Duration
+}
+
+var unsafeCacheChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// path returns the cache file of 'usedAPI' requested at 'baseURL',
+// such as '<dir>/api.t411.ch/categories-tree.json'.
+func (c *diskCache) path(baseURL, usedAPI string) string {
+	base := baseURL
+	if u, err := url.Parse(baseURL); err == nil && len(u.Host) != 0 {
+		base = u.Host + u.Path
+	}
+	base = strings.Trim(unsafeCacheChars.ReplaceAllString(base, "_"), "_.")
+	return filepath.Join(c.dir, base, strings.Replace(strings.Trim(usedAPI, "/"), "/", "-", -1)+".json")
+}
+
+// load returns the cached response of 'usedAPI' requested
+// at 'baseURL', nil if there is none.
+func (c *diskCache) load(baseURL, usedAPI string) (*cacheEntry, error) {
+	path := c.path(baseURL, usedAPI)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := &cacheEntry{}
+	err = json.Unmarshal(data, entry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache file %s: %s", path, err)
+	}
+	return entry, nil
+}
+
+func (c *diskCache) save(baseURL, usedAPI string, entry *cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	path := c.path(baseURL, usedAPI)
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	return atomicfile.Write(path, data, 0600)
+}
+
+func (c *diskCache) isFresh(entry *cacheEntry) bool {
+	return time.Since(entry.Fetched) < c.ttl
+}
+
+// getCached does a GET request on 'usedAPI' and decodes the response into 'data',
+// using the cache of the client, if any, to avoid or revalidate the request.
+func (t *T411) getCached(ctx context.Context, usedAPI string, u *url.URL, data interface{}) error {
+	if t.cache == nil {
+		resp, err := t.do(ctx, "GET", u, nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		return t.decode(ctx, data, resp, usedAPI, u.RawQuery)
+	}
+	// the base url is taken from 'u' as the client may switch mirrors meanwhile
+	baseURL := cacheBaseURL(u, usedAPI)
+	entry, err := t.cache.load(baseURL, usedAPI)
+	if err != nil {
+		t.logger.Printf("Ignoring cached '%s' API response: %v", usedAPI, err)
+		entry = nil
+	}
+	if entry != nil && t.cache.isFresh(entry) && json.Unmarshal(entry.Body, data) == nil {
+		return nil
+	}
+	body, err := t.revalidate(ctx, baseURL, usedAPI, u, entry)
+	if err != nil {
+		if entry == nil || ctx.Err() != nil {
+			return err
+		}
+		t.logger.Printf("Using expired cached '%s' API response: %v", usedAPI, err)
+		body = entry.Body
+	}
+	if err = json.Unmarshal(body, data); err != nil {
+		t.logger.Printf("Error decoding using '%s' API for '%s' query :%v", usedAPI, u.RawQuery, err)
+		return err
+	}
+	return nil
+}
+
+// revalidate requests 'usedAPI' conditionally to the cached 'entry' of 'baseURL',
+// if any, and returns the up to date response body, saving it in the cache under
+// the base url of the mirror that answered.
+func (t *T411) revalidate(ctx context.Context, baseURL, usedAPI string, u *url.URL, entry *cacheEntry) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if len(entry.ETag) != 0 {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if len(entry.LastModified) != 0 {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+	resp, err := t.doAuthorized(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil && responseBaseURL(resp, baseURL, usedAPI) == baseURL {
+		entry.Fetched = time.Now()
+		t.saveCached(baseURL, usedAPI, entry)
+		return entry.Body, nil
+	}
+	resp, body, err := t.readResponse(ctx, resp, usedAPI)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK || !json.Valid(body) {
+		return nil, fmt.Errorf("unexpected response using '%s' API: %s", usedAPI, resp.Status)
+	}
+	t.saveCached(responseBaseURL(resp, baseURL, usedAPI), usedAPI, &cacheEntry{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+		Body:         body,
+	})
+	return body, nil
+}
+
+func (t *T411) saveCached(baseURL, usedAPI string, entry *cacheEntry) {
+	err := t.cache.save(baseURL, usedAPI, entry)
+	if err != nil {
+		t.logger.Printf("Error caching '%s' API response: %v", usedAPI, err)
+	}
+}
+
+// responseBaseURL returns the base url of the request answered by 'resp',
+// which differs from the requested one if the client failed over to a mirror.
+func responseBaseURL(resp *http.Response, requested, usedAPI string) string {
+	if resp.Request == nil || resp.Request.URL == nil {
+		return requested
+	}
+	return cacheBaseURL(resp.Request.URL, usedAPI)
+}
+
+// cacheBaseURL returns the base url of the request 'u' on 'usedAPI'.
+func cacheBaseURL(u *url.URL, usedAPI string) string {
+	base := *u
+	base.RawQuery = ""
+	base.Path = strings.TrimSuffix(u.Path, usedAPI)
+	return base.String()
+}
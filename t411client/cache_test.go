@@ -0,0 +1,206 @@
+package t411client
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dns-gh/t411-client/t411client/t411test"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) createCachedClient(c *C, dir string, ttl time.Duration) *T411 {
+	t411, err := New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithCache(dir, ttl),
+	)
+	c.Assert(err, IsNil)
+	return t411
+}
+
+// cacheFile returns the file caching the responses of 'usedAPI' at 'baseURL'.
+func cacheFile(dir, baseURL, usedAPI string) string {
+	return (&diskCache{dir: dir}).path(baseURL, usedAPI)
+}
+
+// unreachableTransport fails the requests to 'path' as if the API was down.
+type unreachableTransport struct {
+	path string
+}
+
+func (u unreachableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == u.path {
+		return nil, errors.New("connection refused")
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (s *MySuite) TestCache(c *C) {
+	dir := filepath.Join(c.MkDir(), "cache")
+	t411 := s.createCachedClient(c, dir, time.Hour)
+	categories, err := t411.CategoriesTree()
+	c.Assert(err, IsNil)
+	checkCategories(c, categories.Categories)
+	termsTree, err := t411.TermsTree()
+	c.Assert(err, IsNil)
+	checkTermsTree(c, termsTree.ByCategoryID)
+	info, err := os.Stat(cacheFile(dir, s.server.URL, CategoriesTreeEndpoint))
+	c.Assert(err, IsNil)
+	c.Assert(info.Mode().Perm(), Equals, os.FileMode(0600))
+
+	// fresh trees are served from the cache, even to another client
+	t411 = s.createCachedClient(c, dir, time.Hour)
+	cached, err := t411.CategoriesTree()
+	c.Assert(err, IsNil)
+	c.Assert(cached, DeepEquals, categories)
+	cachedTerms, err := t411.TermsTree()
+	c.Assert(err, IsNil)
+	c.Assert(cachedTerms, DeepEquals, termsTree)
+	c.Assert(s.server.Hits(t411test.CategoriesTreeAPI), Equals, 1)
+	c.Assert(s.server.Hits(t411test.TermsTreeAPI), Equals, 1)
+
+	// expired trees are revalidated
+	t411 = s.createCachedClient(c, dir, 0)
+	cached, err = t411.CategoriesTree()
+	c.Assert(err, IsNil)
+	c.Assert(cached, DeepEquals, categories)
+	c.Assert(s.server.Hits(t411test.CategoriesTreeAPI), Equals, 2)
+	s.server.SetCategories(map[string]t411test.Category{
+		"395": {ID: "395", Pid: "0", Name: "Audio"},
+	})
+	cached, err = t411.CategoriesTree()
+	c.Assert(err, IsNil)
+	c.Assert(cached.Categories, DeepEquals, map[string]Category{
+		"395": {ID: "395", Pid: "0", Name: "Audio"},
+	})
+	c.Assert(s.server.Hits(t411test.CategoriesTreeAPI), Equals, 3)
+
+	// expired trees are served when the API fails
+	s.server.InjectError(t411test.CategoriesTreeAPI, 500)
+	cached, err = t411.CategoriesTree()
+	c.Assert(err, IsNil)
+	c.Assert(cached.Categories, HasLen, 1)
+	t411, err = New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithCache(dir, 0),
+		WithRetryPolicy(fastRetryPolicy),
+		WithTransport(unreachableTransport{path: CategoriesTreeEndpoint}),
+	)
+	c.Assert(err, IsNil)
+	cached, err = t411.CategoriesTree()
+	c.Assert(err, IsNil)
+	c.Assert(cached.Categories, HasLen, 1)
+
+	// but not when nothing has been cached
+	t411 = s.createCachedClient(c, c.MkDir(), time.Hour)
+	s.server.InjectError(t411test.CategoriesTreeAPI, 500)
+	_, err = t411.CategoriesTree()
+	c.Assert(err, FitsTypeOf, &APIError{})
+}
+
+func (s *MySuite) TestCacheInvalidFile(c *C) {
+	dir := c.MkDir()
+	path := cacheFile(dir, s.server.URL, TermsTreeEndpoint)
+	c.Assert(os.MkdirAll(filepath.Dir(path), 0700), IsNil)
+	c.Assert(ioutil.WriteFile(path, []byte("{"), 0600), IsNil)
+	t411 := s.createCachedClient(c, dir, time.Hour)
+	termsTree, err := t411.TermsTree()
+	c.Assert(err, IsNil)
+	checkTermsTree(c, termsTree.ByCategoryID)
+	c.Assert(s.server.Hits(t411test.TermsTreeAPI), Equals, 1)
+	_, err = t411.TermsTree()
+	c.Assert(err, IsNil)
+	c.Assert(s.server.Hits(t411test.TermsTreeAPI), Equals, 1)
+}
+
+func (s *MySuite) TestCacheByBaseURL(c *C) {
+	c.Assert(cacheFile("cache", "https://api.t411.ch", CategoriesTreeEndpoint), Equals,
+		filepath.Join("cache", "api.t411.ch", "categories-tree.json"))
+	c.Assert(cacheFile("cache", "http://127.0.0.1:8080/v1/", TermsTreeEndpoint), Equals,
+		filepath.Join("cache", "127.0.0.1_8080_v1", "terms-tree.json"))
+
+	// responses of another API are not served from the cache
+	dir := c.MkDir()
+	other := t411test.NewServer()
+	defer other.Close()
+	seedServer(other)
+	other.SetCategories(map[string]t411test.Category{
+		"395": {ID: "395", Pid: "0", Name: "Audio"},
+	})
+	t411 := s.createCachedClient(c, dir, time.Hour)
+	categories, err := t411.CategoriesTree()
+	c.Assert(err, IsNil)
+	checkCategories(c, categories.Categories)
+	t411, err = New(
+		WithBaseURL(other.URL),
+		WithCredentials(testUsername, testPassword),
+		WithCache(dir, time.Hour),
+	)
+	c.Assert(err, IsNil)
+	categories, err = t411.CategoriesTree()
+	c.Assert(err, IsNil)
+	c.Assert(categories.Categories, HasLen, 1)
+	c.Assert(other.Hits(t411test.CategoriesTreeAPI), Equals, 1)
+}
+
+// validatorsTransport records the If-None-Match headers of the requests by host.
+type validatorsTransport struct {
+	mu     sync.Mutex
+	byHost map[string][]string
+}
+
+func (v *validatorsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	v.mu.Lock()
+	v.byHost[req.URL.Host] = append(v.byHost[req.URL.Host], req.Header.Get("If-None-Match"))
+	v.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (s *MySuite) TestCacheMirrorFailover(c *C) {
+	other := t411test.NewServer()
+	defer other.Close()
+	seedServer(other)
+	other.SetCategories(map[string]t411test.Category{
+		"395": {ID: "395", Pid: "0", Name: "Audio"},
+	})
+	dir := c.MkDir()
+	transport := &validatorsTransport{byHost: map[string][]string{}}
+	t411, err := New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithMirrors(s.server.URL, other.URL),
+		WithCache(dir, 0),
+		WithRetryPolicy(fastRetryPolicy),
+		WithTransport(transport),
+	)
+	c.Assert(err, IsNil)
+	categories, err := t411.CategoriesTree()
+	c.Assert(err, IsNil)
+	checkCategories(c, categories.Categories)
+	cached, err := ioutil.ReadFile(cacheFile(dir, s.server.URL, CategoriesTreeEndpoint))
+	c.Assert(err, IsNil)
+
+	// the response of the mirror failed over to is cached under its own base
+	// url and the validators of the dead mirror are not sent to it
+	s.server.Close()
+	categories, err = t411.CategoriesTree()
+	c.Assert(err, IsNil)
+	c.Assert(categories.Categories, HasLen, 1)
+	validators := transport.byHost[strings.TrimPrefix(other.URL, "http://")]
+	c.Assert(validators, Not(HasLen), 0)
+	for _, validator := range validators {
+		c.Assert(validator, Equals, "")
+	}
+	data, err := ioutil.ReadFile(cacheFile(dir, s.server.URL, CategoriesTreeEndpoint))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, string(cached))
+	_, err = os.Stat(cacheFile(dir, other.URL, CategoriesTreeEndpoint))
+	c.Assert(err, IsNil)
+}
@@ -1,9 +1,19 @@
 package t411client
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 )
 
+// ErrCategoryNotFound is returned when a category name matches
+// none of the categories of the tree.
+var ErrCategoryNotFound = errors.New("category not found")
+
 // Category represents the category data
 type Category struct {
 	ID   string              `json:"id"`
@@ -17,24 +27,87 @@ type Categories struct {
 	Categories map[string]Category
 }
 
-// CategoriesTree gets the categories tree
+// CategoriesTree gets the categories tree.
+// It is served from the cache of the client, if any. See WithCache.
 func (t *T411) CategoriesTree() (*Categories, error) {
+	return t.CategoriesTreeContext(context.Background())
+}
+
+// CategoriesTreeContext does the same as CategoriesTree using the
+// provided context for the underlying http requests.
+func (t *T411) CategoriesTreeContext(ctx context.Context) (*Categories, error) {
 	usedAPI := "/categories/tree"
-	u, err := url.Parse(t.baseURL + usedAPI)
+	u, err := url.Parse(t.getBaseURL() + usedAPI)
 	if err != nil {
-		return nil, ErrURLParsing
+		return nil, fmt.Errorf("%w: %s", ErrURLParsing, err)
 	}
 
-	resp, err := t.do("GET", u, nil)
+	categories := &Categories{}
+	err = t.getCached(ctx, usedAPI, u, &categories.Categories)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return categories, nil
+}
 
-	categories := &Categories{}
-	err = t.decode(&categories.Categories, resp, usedAPI, u.RawQuery)
+// IDs returns the id of the category followed by the ids of all its subcategories.
+func (c *Category) IDs() []int {
+	IDs := []int{}
+	if ID, err := strconv.Atoi(c.ID); err == nil {
+		IDs = append(IDs, ID)
+	}
+	for _, v := range c.Cats {
+		IDs = append(IDs, v.IDs()...)
+	}
+	return IDs
+}
+
+func findCategories(categories map[string]Category, name string, found []Category) []Category {
+	for _, v := range categories {
+		if len(v.ID) != 0 && (v.ID == name || strings.EqualFold(v.Name, name)) {
+			found = append(found, v)
+		}
+		found = findCategories(v.Cats, name, found)
+	}
+	return found
+}
+
+// Resolve returns the sorted ids of the categories matching the given names.
+// A name matches, case insensitively, the name or the id of a category at any
+// level of the tree and resolves to the category and all its subcategories.
+func (c *Categories) Resolve(names ...string) ([]int, error) {
+	unique := map[int]bool{}
+	for _, name := range names {
+		found := findCategories(c.Categories, strings.TrimSpace(name), nil)
+		if len(found) == 0 {
+			return nil, fmt.Errorf("%w: %q", ErrCategoryNotFound, name)
+		}
+		for _, category := range found {
+			for _, ID := range category.IDs() {
+				unique[ID] = true
+			}
+		}
+	}
+	IDs := []int{}
+	for ID := range unique {
+		IDs = append(IDs, ID)
+	}
+	sort.Ints(IDs)
+	return IDs, nil
+}
+
+// ResolveCategories fetches the categories tree and resolves the given names
+// to category ids, see Categories.Resolve.
+func (t *T411) ResolveCategories(names ...string) ([]int, error) {
+	return t.ResolveCategoriesContext(context.Background(), names...)
+}
+
+// ResolveCategoriesContext does the same as ResolveCategories using the
+// provided context for the underlying http requests.
+func (t *T411) ResolveCategoriesContext(ctx context.Context, names ...string) ([]int, error) {
+	categories, err := t.CategoriesTreeContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return categories, nil
+	return categories.Resolve(names...)
 }
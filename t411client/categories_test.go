@@ -21,9 +21,38 @@ func checkCategories(c *C, categories map[string]Category) {
 }
 
 func (s *MySuite) TestCategoriesTree(c *C) {
-	t411, _, _ := createT411Client(c)
+	t411, _, _ := s.createT411Client(c)
 	categories, err := t411.CategoriesTree()
 	c.Assert(err, IsNil)
 	c.Assert(categories.Categories, Not(HasLen), 0)
 	checkCategories(c, categories.Categories)
 }
+
+func (s *MySuite) TestResolveCategories(c *C) {
+	t411, _, _ := s.createT411Client(c)
+	categories, err := t411.CategoriesTree()
+	c.Assert(err, IsNil)
+
+	IDs, err := categories.Resolve("série tv", "Animation")
+	c.Assert(err, IsNil)
+	c.Assert(IDs, DeepEquals, []int{433, 455})
+	IDs, err = categories.Resolve("Audio", "623")
+	c.Assert(err, IsNil)
+	c.Assert(IDs, DeepEquals, []int{395, 400, 403, 623, 642})
+	IDs, err = t411.ResolveCategories("Film/Vidéo")
+	c.Assert(err, IsNil)
+	c.Assert(IDs, DeepEquals, []int{210, 402, 433, 455, 631, 633, 634, 635, 636, 637, 639})
+	_, err = categories.Resolve("Série TV", "Jeux vidéo")
+	c.Assert(err, ErrorIs, ErrCategoryNotFound)
+	c.Assert(err, ErrorMatches, `category not found: "Jeux vidéo"`)
+
+	torrents, err := t411.Search(NewSearchQuery("vikings").Season(1).CategoryNames(categories, "Film/Vidéo"))
+	c.Assert(err, IsNil)
+	c.Assert(torrents.Total, Equals, "12")
+	torrents, err = t411.Search(NewSearchQuery("vikings").CategoryNames(categories, "Audio"))
+	c.Assert(err, IsNil)
+	c.Assert(torrents.Torrents, HasLen, 0)
+	query := NewSearchQuery("vikings").CategoryNames(categories, "Jeux vidéo")
+	c.Assert(query.Err(), ErrorIs, ErrInvalidQuery)
+	c.Assert(query.Err(), ErrorIs, ErrCategoryNotFound)
+}
@@ -0,0 +1,247 @@
+package t411client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dns-gh/t411-client/t411client/internal/atomicfile"
+	"github.com/dns-gh/t411-client/t411client/sink"
+)
+
+// ErrFileExists is returned when downloading a torrent into a directory
+// where a file with the same name already exists and the collision
+// policy is CollisionFail.
+var ErrFileExists = errors.New("torrent file already exists")
+
+// errContentDisposition is logged when the downloaded torrent filename cannot
+// be extracted from the http response, a filename derived from the id being used.
+var errContentDisposition = errors.New("failed to extract filename from http 'Content-Disposition' header")
+
+// CollisionPolicy represents what to do when downloading a torrent into
+// a directory where a file with the same name already exists.
+type CollisionPolicy int
+
+const (
+	// CollisionOverwrite replaces the existing file.
+	CollisionOverwrite CollisionPolicy = iota
+	// CollisionRename writes the torrent to 'name (1).torrent',
+	// 'name (2).torrent' and so on, whichever does not exist yet.
+	CollisionRename
+	// CollisionFail fails with ErrFileExists.
+	CollisionFail
+)
+
+// maxRenames is the maximum number of names tried with CollisionRename.
+const maxRenames = 1000
+
+// DownloadInfo represents the metadata of a downloaded torrent file.
+type DownloadInfo struct {
+	// Filename is the name of the torrent file given by the API.
+	Filename string
+	// Size is the size of the torrent file in bytes.
+	Size int64
+	// Path is the path of the written file, only set by DownloadTorrentToDir.
+	// It differs from Filename when the file has been renamed to avoid a collision.
+	Path string
+	// Metainfo is the parsed content of the torrent file.
+	Metainfo *Metainfo
+}
+
+// DownloadTorrentTo downloads the torrent and writes the torrent file to 'w'.
+// The ratio and verified checks are applied the same way as DownloadTorrent
+// and nothing is written if the torrent file is invalid, see ErrInvalidTorrent.
+func (t *T411) DownloadTorrentTo(ctx context.Context, torrent *Torrent, w io.Writer) (*DownloadInfo, error) {
+	filename, data, metainfo, err := t.downloadTorrent(ctx, torrent)
+	if err != nil {
+		return nil, err
+	}
+	n, err := w.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	return &DownloadInfo{
+		Filename: filename,
+		Size:     int64(n),
+		Metainfo: metainfo,
+	}, nil
+}
+
+// DownloadTorrentToDir downloads the torrent into the directory 'dir'.
+// The torrent file is written atomically, so that no partial file is ever
+// visible in 'dir', with the permissions set with WithFileMode and existing
+// files are handled according to the policy set with WithCollisionPolicy.
+// Nothing is written if the torrent file is invalid, see ErrInvalidTorrent.
+func (t *T411) DownloadTorrentToDir(ctx context.Context, torrent *Torrent, dir string) (*DownloadInfo, error) {
+	filename, data, metainfo, err := t.downloadTorrent(ctx, torrent)
+	if err != nil {
+		return nil, err
+	}
+	path, err := t.writeTorrentFile(dir, filename, data)
+	if err != nil {
+		return nil, err
+	}
+	return &DownloadInfo{
+		Filename: filename,
+		Size:     int64(len(data)),
+		Path:     path,
+		Metainfo: metainfo,
+	}, nil
+}
+
+// SendTorrent downloads the torrent and hands the torrent file over to 's',
+// a BitTorrent client or a watched folder for instance, see the sink package.
+// The ratio and verified checks are applied the same way as DownloadTorrent
+// and nothing is sent if the torrent file is invalid, see ErrInvalidTorrent.
+func (t *T411) SendTorrent(ctx context.Context, torrent *Torrent, s sink.TorrentSink) (*DownloadInfo, error) {
+	filename, data, metainfo, err := t.downloadTorrent(ctx, torrent)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Add(ctx, filename, data)
+	if err != nil {
+		return nil, fmt.Errorf("torrent %s: %w", torrent.ID, err)
+	}
+	return &DownloadInfo{
+		Filename: filename,
+		Size:     int64(len(data)),
+		Metainfo: metainfo,
+	}, nil
+}
+
+// writeTorrentFile writes 'data' to a temporary file in 'dir' and moves
+// it to its final name, returning the path of the written file.
+func (t *T411) writeTorrentFile(dir, filename string, data []byte) (string, error) {
+	tmp, err := atomicfile.WriteTemp(dir, ".t411-*.tmp", data, t.fileMode)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp)
+	path := filepath.Join(dir, filename)
+	if t.collision == CollisionOverwrite {
+		return path, os.Rename(tmp, path)
+	}
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	for i := 0; i < maxRenames; i++ {
+		if i > 0 {
+			path = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", base, i, ext))
+		}
+		err = atomicfile.Publish(tmp, path)
+		if err == nil {
+			return path, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+		if t.collision == CollisionFail {
+			return "", fmt.Errorf("%w: %s", ErrFileExists, path)
+		}
+	}
+	return "", fmt.Errorf("%w: %s and %d renamed ones", ErrFileExists, filepath.Join(dir, filename), maxRenames-1)
+}
+
+// filenameParam matches the filename parameters of headers
+// that mime.ParseMediaType rejects, quoted or not.
+var filenameParam = regexp.MustCompile(`(?i)(?:^|;)\s*filename\s*=\s*(?:"((?:[^"\\]|\\.)*)"|([^;]*))`)
+
+// parseContentDisposition returns the sanitized filename given by
+// a Content-Disposition header. See sanitizeFilename.
+func parseContentDisposition(header string) (string, error) {
+	if len(strings.TrimSpace(header)) == 0 {
+		return "", fmt.Errorf("%w: header not found in http response", errContentDisposition)
+	}
+	filename := ""
+	_, params, err := mime.ParseMediaType(header)
+	if err == nil {
+		filename = params["filename"]
+	}
+	// mime.ParseMediaType only decodes the utf-8 and us-ascii extended values
+	if extended := extendedFilename(header); len(extended) != 0 {
+		filename = extended
+	}
+	if len(filename) == 0 {
+		if match := filenameParam.FindStringSubmatch(header); match != nil {
+			filename = match[2]
+			if len(match[1]) != 0 {
+				filename = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(match[1])
+			}
+		}
+	}
+	filename = sanitizeFilename(filename)
+	if len(filename) == 0 {
+		return "", fmt.Errorf("%w: no valid filename in %q", errContentDisposition, header)
+	}
+	return filename, nil
+}
+
+// extendedFilename decodes the RFC 5987 'filename*' parameter of a header,
+// in utf-8 or latin1, returning an empty string if there is none.
+func extendedFilename(header string) string {
+	for _, param := range strings.Split(header, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), "filename*") {
+			continue
+		}
+		parts := strings.SplitN(strings.Trim(strings.TrimSpace(value), `"`), "'", 3)
+		if len(parts) != 3 {
+			return ""
+		}
+		decoded, err := url.PathUnescape(parts[2])
+		if err != nil {
+			return ""
+		}
+		switch strings.ToLower(parts[0]) {
+		case "utf-8", "us-ascii", "":
+			return decoded
+		case "iso-8859-1", "latin1":
+			return latin1ToUTF8(decoded)
+		}
+		return ""
+	}
+	return ""
+}
+
+func latin1ToUTF8(s string) string {
+	runes := make([]rune, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		runes = append(runes, rune(s[i]))
+	}
+	return string(runes)
+}
+
+// sanitizeFilename makes 'filename' safe to join to a directory: any
+// directory part is dropped, as well as control characters and leading dots,
+// and invalid utf-8, which the API sends for latin1 names, is decoded as latin1.
+func sanitizeFilename(filename string) string {
+	if !utf8.ValidString(filename) {
+		filename = latin1ToUTF8(filename)
+	}
+	filename = strings.Replace(filename, `\`, "/", -1)
+	filename = filename[strings.LastIndex(filename, "/")+1:]
+	filename = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filename)
+	return strings.TrimLeft(strings.TrimSpace(filename), ".")
+}
+
+// fallbackFilename returns the filename used when the API does not give a valid one.
+func fallbackFilename(torrentID string) string {
+	ID := sanitizeFilename(torrentID)
+	if len(ID) == 0 {
+		ID = "unknown"
+	}
+	return "t411-" + ID + ".torrent"
+}
@@ -0,0 +1,192 @@
+package t411client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dns-gh/t411-client/t411client/sink"
+	"github.com/dns-gh/t411-client/t411client/t411test"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestDownloadTorrentTo(c *C) {
+	data := t411test.TorrentFile("Data")
+	s.server.AddTorrent(
+		t411test.Torrent{ID: "1", Name: "Data", Data: data},
+		t411test.Torrent{ID: "2", Name: "Error", Data: []byte("<html><body>Error</body></html>")},
+		t411test.Torrent{ID: "3", Name: "Truncated", Data: data[:len(data)-10]},
+	)
+	t411, _, _ := s.createT411Client(c)
+	buffer := &bytes.Buffer{}
+	info, err := t411.DownloadTorrentTo(context.Background(), &Torrent{ID: "1"}, buffer)
+	c.Assert(err, IsNil)
+	c.Assert(info, DeepEquals, &DownloadInfo{
+		Filename: "Data.torrent",
+		Size:     int64(len(data)),
+		Metainfo: &Metainfo{
+			InfoHash:     "6cce8f061838512bf171f1e4540fdd090b37b025",
+			Name:         "Data.mkv",
+			Files:        []File{{Path: "Data.mkv", Length: 1024}},
+			PieceLength:  16384,
+			TotalSize:    1024,
+			AnnounceURLs: []string{"http://tracker.t411.test/announce"},
+		},
+	})
+	c.Assert(buffer.Bytes(), DeepEquals, data)
+
+	for _, ID := range []string{"2", "3"} {
+		_, err = t411.DownloadTorrentTo(context.Background(), &Torrent{ID: ID}, buffer)
+		c.Assert(err, ErrorIs, ErrInvalidTorrent)
+		_, err = t411.DownloadTorrentToDir(context.Background(), &Torrent{ID: ID}, c.MkDir())
+		c.Assert(err, ErrorIs, ErrInvalidTorrent)
+	}
+	_, err = t411.DownloadTorrentTo(context.Background(), &Torrent{ID: "4"}, buffer)
+	c.Assert(err, ErrorIs, ErrTorrentNotFound)
+	c.Assert(buffer.Len(), Equals, len(data))
+}
+
+func (s *MySuite) TestSendTorrent(c *C) {
+	data := t411test.TorrentFile("Data")
+	s.server.AddTorrent(
+		t411test.Torrent{ID: "1", Name: "Data", Data: data},
+		t411test.Torrent{ID: "2", Name: "Error", Data: []byte("<html><body>Error</body></html>")},
+	)
+	t411, _, _ := s.createT411Client(c)
+	dir := c.MkDir()
+	info, err := t411.SendTorrent(context.Background(), &Torrent{ID: "1"}, sink.NewWatchFolder(dir))
+	c.Assert(err, IsNil)
+	c.Assert(info.Filename, Equals, "Data.torrent")
+	c.Assert(info.Size, Equals, int64(len(data)))
+	written, err := ioutil.ReadFile(filepath.Join(dir, "Data.torrent"))
+	c.Assert(err, IsNil)
+	c.Assert(written, DeepEquals, data)
+
+	_, err = t411.SendTorrent(context.Background(), &Torrent{ID: "2"}, sink.NewWatchFolder(dir))
+	c.Assert(err, ErrorIs, ErrInvalidTorrent)
+	_, err = t411.SendTorrent(context.Background(), &Torrent{ID: "1"}, sink.NewWatchFolder(filepath.Join(dir, "missing")))
+	c.Assert(err, ErrorMatches, "torrent 1: .*no such file or directory")
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+}
+
+func (s *MySuite) TestDownloadTorrentToDir(c *C) {
+	dir := c.MkDir()
+	torrent := &Torrent{ID: "4831500"}
+	name := "Vikings.S01E01.HDTV.x264.2HD.VOSTFR"
+	t411, err := New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithFileMode(0600),
+		WithCollisionPolicy(CollisionRename),
+	)
+	c.Assert(err, IsNil)
+	for i, expected := range []string{name + ".torrent", name + " (1).torrent", name + " (2).torrent"} {
+		info, err := t411.DownloadTorrentToDir(context.Background(), torrent, dir)
+		c.Assert(err, IsNil)
+		c.Assert(info.Filename, Equals, name+".torrent")
+		c.Assert(info.Path, Equals, filepath.Join(dir, expected))
+		stat, err := os.Stat(info.Path)
+		c.Assert(err, IsNil)
+		c.Assert(stat.Size(), Equals, info.Size)
+		c.Assert(stat.Mode().Perm(), Equals, os.FileMode(0600))
+		files, err := ioutil.ReadDir(dir)
+		c.Assert(err, IsNil)
+		c.Assert(files, HasLen, i+1)
+	}
+
+	t411, err = New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithCollisionPolicy(CollisionFail),
+	)
+	c.Assert(err, IsNil)
+	_, err = t411.DownloadTorrentToDir(context.Background(), torrent, dir)
+	c.Assert(err, ErrorIs, ErrFileExists)
+
+	// files are overwritten by default
+	t411, _, _ = s.createT411Client(c)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, name+".torrent"), []byte("old"), 0600), IsNil)
+	info, err := t411.DownloadTorrentToDir(context.Background(), torrent, dir)
+	c.Assert(err, IsNil)
+	c.Assert(info.Path, Equals, filepath.Join(dir, name+".torrent"))
+	content, err := ioutil.ReadFile(info.Path)
+	c.Assert(err, IsNil)
+	c.Assert(int64(len(content)), Equals, info.Size)
+	stat, err := os.Stat(info.Path)
+	c.Assert(err, IsNil)
+	c.Assert(stat.Mode().Perm(), Equals, os.FileMode(0644))
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 3)
+
+	_, err = t411.DownloadTorrentToDir(context.Background(), torrent, filepath.Join(dir, "missing"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *MySuite) TestParseContentDisposition(c *C) {
+	for header, expected := range map[string]string{
+		`attachment; filename="Vikings.S01E01.torrent"`:                                   "Vikings.S01E01.torrent",
+		`attachment; filename=Vikings.S01E01.torrent`:                                     "Vikings.S01E01.torrent",
+		`attachment; filename=Vikings S01E01.torrent`:                                     "Vikings S01E01.torrent",
+		`attachment; filename="The \"Best\" Show.torrent"`:                                `The "Best" Show.torrent`,
+		`attachment; filename*=UTF-8''S%C3%A9rie%20TV.torrent`:                            "Série TV.torrent",
+		`attachment; filename*=iso-8859-1''S%E9rie.torrent`:                               "Série.torrent",
+		`attachment; filename="ete.torrent"; filename*=UTF-8''%C3%A9t%C3%A9.torrent`:      "été.torrent",
+		"attachment; filename=\"S\xe9rie.torrent\"":                                       "Série.torrent",
+		"attachment; filename=\"Série.torrent\"":                                          "Série.torrent",
+		`attachment; filename="../../etc/passwd"`:                                         "passwd",
+		`attachment; filename="..\\..\\evil.torrent"`:                                     "evil.torrent",
+		`attachment; filename=".hidden.torrent"`:                                          "hidden.torrent",
+		`attachment; filename*=UTF-8''..%2F..%2Fevil.torrent`:                             "evil.torrent",
+		"attachment; filename=\"bell\x07.torrent\"":                                       "bell.torrent",
+		`attachment; filename*=klingon''S%E9rie.torrent; filename="Serie.torrent"`:        "Serie.torrent",
+		`inline; FILENAME="Upper.torrent"`:                                                "Upper.torrent",
+		`attachment; filename="Vikings.S01E01.torrent"; size=1234; creation-date="today"`: "Vikings.S01E01.torrent",
+	} {
+		filename, err := parseContentDisposition(header)
+		c.Assert(err, IsNil, Commentf("header %q", header))
+		c.Assert(filename, Equals, expected, Commentf("header %q", header))
+	}
+	for _, header := range []string{
+		"",
+		"attachment",
+		`attachment; filename=""`,
+		`attachment; filename="../"`,
+		`attachment; filename=".."`,
+	} {
+		_, err := parseContentDisposition(header)
+		c.Assert(err, ErrorIs, errContentDisposition, Commentf("header %q", header))
+	}
+	c.Assert(fallbackFilename("4831500"), Equals, "t411-4831500.torrent")
+	c.Assert(fallbackFilename("../1"), Equals, "t411-1.torrent")
+	c.Assert(fallbackFilename(""), Equals, "t411-unknown.torrent")
+}
+
+func (s *MySuite) TestDownloadTorrentFilename(c *C) {
+	s.server.AddTorrent(
+		t411test.Torrent{ID: "1", Name: "../Série"},
+		t411test.Torrent{ID: "2", Name: `The "Best" Show`},
+		t411test.Torrent{ID: "3", ContentDisposition: "-"},
+		t411test.Torrent{ID: "4", ContentDisposition: `attachment; filename="/"`},
+	)
+	t411, _, _ := s.createT411Client(c)
+	dir := c.MkDir()
+	for ID, expected := range map[string]string{
+		"1": "Série.torrent",
+		"2": `The "Best" Show.torrent`,
+		"3": "t411-3.torrent",
+		"4": "t411-4.torrent",
+	} {
+		info, err := t411.DownloadTorrentToDir(context.Background(), &Torrent{ID: ID}, dir)
+		c.Assert(err, IsNil)
+		c.Assert(info.Filename, Equals, expected)
+		c.Assert(info.Path, Equals, filepath.Join(dir, expected))
+	}
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 4)
+}
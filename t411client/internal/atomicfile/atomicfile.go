@@ -0,0 +1,100 @@
+// Package atomicfile writes files so that they are never seen partially
+// written: the data is written and synced to a temporary file in the same
+// directory, which is then renamed or linked to its final name.
+package atomicfile
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// link creates 'path' as a hard link to 'tmp', replaced in tests.
+var link = os.Link
+
+// WriteTemp writes 'data' with permission 'mode' to a new temporary file of
+// the directory 'dir', named after 'pattern' like ioutil.TempFile, syncs it and
+// returns its name. It is up to the caller to remove the temporary file.
+func WriteTemp(dir, pattern string, data []byte, mode os.FileMode) (string, error) {
+	tmp, err := ioutil.TempFile(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// Write writes 'data' with permission 'mode' to 'path',
+// replacing the file if it already exists.
+func Write(path string, data []byte, mode os.FileMode) error {
+	tmp, err := WriteTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp", data, mode)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	return os.Rename(tmp, path)
+}
+
+// Publish gives the temporary file 'tmp' the name 'path', in the same directory,
+// unless a file already exists there, in which case an error satisfying
+// os.IsExist is returned. 'tmp' is left in place and must be removed afterwards.
+//
+// A hard link is used since renaming replaces existing files. On file systems
+// not supporting hard links, like FAT or some network shares, 'path' is created
+// exclusively to reserve the name and 'tmp' is copied over it instead, so that
+// the empty file may be seen for a short while.
+func Publish(tmp, path string) error {
+	err := link(tmp, path)
+	if err == nil || !linkUnsupported(err) {
+		return err
+	}
+	reserved, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	err = reserved.Close()
+	if err == nil {
+		err = copyFile(tmp, path)
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// linkUnsupported reports whether linking failed because
+// the file system does not support hard links.
+func linkUnsupported(err error) bool {
+	return errors.Is(err, syscall.EPERM) ||
+		errors.Is(err, syscall.ENOTSUP) ||
+		errors.Is(err, syscall.EOPNOTSUPP)
+}
+
+// copyFile writes a copy of 'tmp' to another temporary file and renames it over
+// 'path', 'tmp' being kept so that it can be published again on failure.
+func copyFile(tmp, path string) error {
+	data, err := ioutil.ReadFile(tmp)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return err
+	}
+	return Write(path, data, info.Mode().Perm())
+}
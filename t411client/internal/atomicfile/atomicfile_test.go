@@ -0,0 +1,90 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type MySuite struct{}
+
+var _ = Suite(&MySuite{})
+
+func readDir(c *C, dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	return names
+}
+
+func (s *MySuite) TestWrite(c *C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "token")
+	c.Assert(Write(path, []byte("first"), 0600), IsNil)
+	c.Assert(Write(path, []byte("second"), 0644), IsNil)
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "second")
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Assert(info.Mode().Perm(), Equals, os.FileMode(0644))
+	c.Assert(readDir(c, dir), DeepEquals, []string{"token"})
+
+	err = Write(filepath.Join(dir, "missing", "token"), []byte("data"), 0600)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *MySuite) checkPublish(c *C) {
+	dir := c.MkDir()
+	tmp, err := WriteTemp(dir, ".test-*.tmp", []byte("data"), 0640)
+	c.Assert(err, IsNil)
+	defer os.Remove(tmp)
+	path := filepath.Join(dir, "test.torrent")
+	c.Assert(Publish(tmp, path), IsNil)
+	err = Publish(tmp, path)
+	c.Assert(os.IsExist(err), Equals, true, Commentf("%v", err))
+	c.Assert(Publish(tmp, filepath.Join(dir, "test (1).torrent")), IsNil)
+	c.Assert(os.Remove(tmp), IsNil)
+	c.Assert(readDir(c, dir), DeepEquals, []string{"test (1).torrent", "test.torrent"})
+	for _, name := range readDir(c, dir) {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, "data")
+		info, err := os.Stat(filepath.Join(dir, name))
+		c.Assert(err, IsNil)
+		c.Assert(info.Mode().Perm(), Equals, os.FileMode(0640))
+	}
+}
+
+func (s *MySuite) TestPublish(c *C) {
+	s.checkPublish(c)
+}
+
+func (s *MySuite) TestPublishWithoutHardLinks(c *C) {
+	defer func() {
+		link = os.Link
+	}()
+	for _, errno := range []syscall.Errno{syscall.EPERM, syscall.ENOTSUP} {
+		link = func(oldname, newname string) error {
+			return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errno}
+		}
+		s.checkPublish(c)
+	}
+	link = os.Link
+
+	// other errors are returned as is
+	dir := c.MkDir()
+	tmp, err := WriteTemp(dir, ".test-*.tmp", []byte("data"), 0600)
+	c.Assert(err, IsNil)
+	err = Publish(tmp, filepath.Join(dir, "missing", "test.torrent"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
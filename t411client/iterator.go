@@ -0,0 +1,132 @@
+package t411client
+
+import (
+	"context"
+	"strconv"
+)
+
+const defaultPageSize = 100
+
+// SearchIterator iterates over all the torrents matching a search query,
+// fetching them lazily one page at a time.
+// Torrents are deduplicated by id since results can shift between pages
+// when torrents are added or removed in the meantime.
+type SearchIterator struct {
+	client   *T411
+	ctx      context.Context
+	query    *SearchQuery
+	pageSize int
+	start    int
+	offset   int
+	total    int
+	seen     map[string]bool
+	buffer   []Torrent
+	done     bool
+	err      error
+}
+
+// Iterate returns an iterator over all the torrents matching the query,
+// fetching 'pageSize' torrents per request, 100 if 'pageSize' is lower than 1.
+// The iteration starts at the offset of the query, if any,
+// and the limit of the query is ignored.
+func (t *T411) Iterate(query *SearchQuery, pageSize int) *SearchIterator {
+	return t.IterateContext(context.Background(), query, pageSize)
+}
+
+// IterateContext does the same as Iterate using the
+// provided context for the underlying http requests.
+func (t *T411) IterateContext(ctx context.Context, query *SearchQuery, pageSize int) *SearchIterator {
+	if pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	start := query.offset
+	if start < 0 {
+		start = 0
+	}
+	return &SearchIterator{
+		client:   t,
+		ctx:      ctx,
+		query:    query.clone(),
+		pageSize: pageSize,
+		start:    start,
+		offset:   start,
+		total:    -1,
+		seen:     map[string]bool{},
+	}
+}
+
+// Next returns the next torrent, fetching a new page if needed.
+// It returns ErrEOF once all the torrents have been returned.
+func (it *SearchIterator) Next() (*Torrent, error) {
+	for len(it.buffer) == 0 {
+		if it.err != nil {
+			return nil, it.err
+		}
+		if it.done {
+			return nil, ErrEOF
+		}
+		it.fetch()
+	}
+	torrent := it.buffer[0]
+	it.buffer = it.buffer[1:]
+	return &torrent, nil
+}
+
+// All returns all the remaining torrents.
+func (it *SearchIterator) All() ([]Torrent, error) {
+	torrents := []Torrent{}
+	for {
+		torrent, err := it.Next()
+		if err == ErrEOF {
+			return torrents, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		torrents = append(torrents, *torrent)
+	}
+}
+
+// Total returns the total number of torrents matching the query
+// as returned by the last request, or -1 if no request has been done yet.
+func (it *SearchIterator) Total() int {
+	return it.total
+}
+
+func (it *SearchIterator) fetch() {
+	torrents, err := it.client.SearchContext(it.ctx, it.query.Offset(it.offset).Limit(it.pageSize))
+	if err != nil {
+		it.err = err
+		return
+	}
+	total := 0
+	if len(torrents.Total) != 0 {
+		total, err = strconv.Atoi(torrents.Total)
+		if err != nil {
+			it.err = err
+			return
+		}
+	}
+	if it.total > total {
+		// some torrents have been removed, go back to make sure none
+		// is skipped and fetch the page again.
+		it.offset -= it.total - total
+		if it.offset < it.start {
+			it.offset = it.start
+		}
+		it.total = total
+		return
+	}
+	it.total = total
+	count := len(torrents.Torrents) + torrents.Dropped
+	it.offset += count
+	if count == 0 || it.offset >= total {
+		it.done = true
+	}
+	for _, torrent := range torrents.Torrents {
+		if !it.seen[torrent.ID] {
+			it.seen[torrent.ID] = true
+			it.buffer = append(it.buffer, torrent)
+		}
+	}
+}
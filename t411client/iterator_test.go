@@ -0,0 +1,89 @@
+package t411client
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/dns-gh/t411-client/t411client/t411test"
+	. "gopkg.in/check.v1"
+)
+
+func checkUniqueTorrents(c *C, torrents []Torrent) []string {
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, v := range torrents {
+		c.Assert(seen[v.ID], Equals, false)
+		seen[v.ID] = true
+		ids = append(ids, v.ID)
+	}
+	return ids
+}
+
+func (s *MySuite) TestSearchIterator(c *C) {
+	t411, _, _ := s.createT411Client(c)
+	it := t411.Iterate(NewSearchQuery("vikings").Limit(3), 7)
+	c.Assert(it.Total(), Equals, -1)
+	torrents, err := it.All()
+	c.Assert(err, IsNil)
+	c.Assert(torrents, HasLen, 592)
+	c.Assert(it.Total(), Equals, 592)
+	checkUniqueTorrents(c, torrents)
+	c.Assert(s.server.Hits(t411test.TorrentsSearchAPI), Equals, 85)
+	_, err = it.Next()
+	c.Assert(err, Equals, ErrEOF)
+
+	it = t411.Iterate(NewSearchQuery("vikings").Season(1).Episode(1).Offset(10), 0)
+	torrents, err = it.All()
+	c.Assert(err, IsNil)
+	c.Assert(torrents, HasLen, 2)
+
+	it = t411.Iterate(NewSearchQuery("nothing"), 0)
+	_, err = it.Next()
+	c.Assert(err, Equals, ErrEOF)
+	c.Assert(it.Total(), Equals, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = t411.IterateContext(ctx, NewSearchQuery("vikings"), 0).Next()
+	c.Assert(err, ErrorMatches, ".*context canceled")
+}
+
+func (s *MySuite) TestSearchIteratorTotalChanges(c *C) {
+	t411, _, _ := s.createT411Client(c)
+	query := NewSearchQuery("vikings").Season(1).Episode(1)
+
+	// torrents removed after the current page
+	it := t411.Iterate(query, 5)
+	for i := 0; i < 5; i++ {
+		torrent, err := it.Next()
+		c.Assert(err, IsNil)
+		c.Assert(torrent.ID, Equals, strconv.Itoa(4831500+i))
+	}
+	s.server.RemoveTorrent("4831506", "4831507")
+	torrents, err := it.All()
+	c.Assert(err, IsNil)
+	ids := checkUniqueTorrents(c, torrents)
+	c.Assert(ids, DeepEquals, []string{"4831505", "4831508", "4831509", "4831510", "4831511"})
+
+	// torrents removed before the current page
+	it = t411.Iterate(query, 3)
+	for i := 0; i < 3; i++ {
+		_, err := it.Next()
+		c.Assert(err, IsNil)
+	}
+	s.server.RemoveTorrent("4831500", "4831501")
+	torrents, err = it.All()
+	c.Assert(err, IsNil)
+	ids = checkUniqueTorrents(c, torrents)
+	c.Assert(ids, DeepEquals, []string{"4831503", "4831504", "4831505", "4831508", "4831509", "4831510", "4831511"})
+
+	// torrents added
+	it = t411.Iterate(query, 4)
+	_, err = it.Next()
+	c.Assert(err, IsNil)
+	s.server.AddTorrent(t411test.Torrent{ID: "1", Name: "Vikings.S01E01.NEW", TermIDs: []int{968, 937}})
+	torrents, err = it.All()
+	c.Assert(err, IsNil)
+	c.Assert(torrents, HasLen, 8)
+	c.Assert(torrents[7].ID, Equals, "1")
+}
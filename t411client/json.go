@@ -0,0 +1,64 @@
+package t411client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// rawString is a string decoded from any JSON scalar since the t411 API
+// encodes the same fields either as strings, numbers or booleans.
+// Numbers and booleans are kept as written in the JSON and null is empty.
+type rawString string
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (r *rawString) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("unexpected empty JSON value")
+	}
+	switch data[0] {
+	case '"':
+		var s string
+		err := json.Unmarshal(data, &s)
+		*r = rawString(s)
+		return err
+	case '{', '[':
+		return fmt.Errorf("cannot decode JSON %s into a string", data)
+	}
+	if string(data) == "null" {
+		*r = ""
+		return nil
+	}
+	*r = rawString(data)
+	return nil
+}
+
+// decodeObjectList decodes a JSON array, calling 'decode' on each of its object
+// elements. The other elements and the objects that 'decode' fails on are
+// skipped and counted as dropped.
+func decodeObjectList(data []byte, decode func(json.RawMessage) error) (int, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return 0, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	token, err := dec.Token()
+	if err != nil {
+		return 0, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return 0, fmt.Errorf("cannot decode JSON %v into a list", token)
+	}
+	dropped := 0
+	for dec.More() {
+		element := json.RawMessage{}
+		err = dec.Decode(&element)
+		if err != nil {
+			return dropped, err
+		}
+		if element[0] != '{' || decode(element) != nil {
+			dropped++
+		}
+	}
+	_, err = dec.Token()
+	return dropped, err
+}
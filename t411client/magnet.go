@@ -0,0 +1,173 @@
+package t411client
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/dns-gh/t411-client/t411client/internal/atomicfile"
+)
+
+// Magnet returns the magnet URI of the torrent with its info-hash, display
+// name, exact length and trackers.
+func (m *Metainfo) Magnet() string {
+	parts := []string{
+		"xt=urn:btih:" + m.InfoHash,
+		"dn=" + url.QueryEscape(m.Name),
+		fmt.Sprintf("xl=%d", m.TotalSize),
+	}
+	for _, tracker := range m.AnnounceURLs {
+		parts = append(parts, "tr="+url.QueryEscape(tracker))
+	}
+	return "magnet:?" + strings.Join(parts, "&")
+}
+
+// MagnetResult represents the magnet URI of a torrent
+// of a batch or the error preventing to build it.
+type MagnetResult struct {
+	ID  string
+	URI string
+	Err error
+}
+
+// MagnetFor returns the magnet URI of the torrent. The torrent file is downloaded
+// unless it is one of the last ones downloaded by the client or is in the cache
+// directory set with WithCache, the ratio and verified checks being applied as
+// DownloadTorrent.
+func (t *T411) MagnetFor(torrent *Torrent) (string, error) {
+	return t.MagnetForContext(context.Background(), torrent)
+}
+
+// MagnetForContext does the same as MagnetFor using the
+// provided context for the underlying http requests.
+func (t *T411) MagnetForContext(ctx context.Context, torrent *Torrent) (string, error) {
+	metainfo, err := t.metainfoFor(ctx, torrent)
+	if err != nil {
+		return "", err
+	}
+	return metainfo.Magnet(), nil
+}
+
+// MagnetsFor returns the magnet URIs of all the torrents, in order.
+// A torrent failing does not prevent the next ones from being processed.
+func (t *T411) MagnetsFor(torrents *Torrents) []MagnetResult {
+	return t.MagnetsForContext(context.Background(), torrents)
+}
+
+// MagnetsForContext does the same as MagnetsFor using the
+// provided context for the underlying http requests.
+func (t *T411) MagnetsForContext(ctx context.Context, torrents *Torrents) []MagnetResult {
+	results := make([]MagnetResult, 0, len(torrents.Torrents))
+	for i := range torrents.Torrents {
+		torrent := &torrents.Torrents[i]
+		result := MagnetResult{ID: torrent.ID}
+		if result.Err = ctx.Err(); result.Err == nil {
+			result.URI, result.Err = t.MagnetForContext(ctx, torrent)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// metainfoFor returns the metainfo of the torrent, from the
+// memory or disk caches if possible, downloading it otherwise.
+func (t *T411) metainfoFor(ctx context.Context, torrent *Torrent) (*Metainfo, error) {
+	if metainfo := t.metainfos.get(torrent.ID); metainfo != nil {
+		return metainfo, nil
+	}
+	if t.cache != nil {
+		data, err := ioutil.ReadFile(t.cache.torrentPath(torrent.ID))
+		if err == nil {
+			metainfo, err := ParseMetainfo(data)
+			if err == nil {
+				t.metainfos.add(torrent.ID, metainfo)
+				return metainfo, nil
+			}
+		}
+		if err != nil && !os.IsNotExist(err) {
+			t.logger.Printf("Ignoring cached torrent %s: %v", torrent.ID, err)
+		}
+	}
+	_, data, metainfo, err := t.downloadTorrent(ctx, torrent)
+	if err != nil {
+		return nil, err
+	}
+	if t.cache != nil {
+		err = t.cache.saveTorrent(torrent.ID, data)
+		if err != nil {
+			t.logger.Printf("Error caching torrent %s: %v", torrent.ID, err)
+		}
+	}
+	return metainfo, nil
+}
+
+// maxCachedMetainfos is the number of metainfos kept in memory by a client.
+const maxCachedMetainfos = 64
+
+// metainfoCache keeps the metainfo of the last downloaded torrents by id,
+// dropping the least recently used ones beyond 'max'.
+type metainfoCache struct {
+	mu    sync.Mutex
+	max   int
+	byID  map[string]*list.Element
+	order *list.List
+}
+
+type metainfoCacheEntry struct {
+	ID       string
+	Metainfo *Metainfo
+}
+
+func newMetainfoCache(max int) *metainfoCache {
+	return &metainfoCache{
+		max:   max,
+		byID:  map[string]*list.Element{},
+		order: list.New(),
+	}
+}
+
+func (c *metainfoCache) get(ID string) *Metainfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element := c.byID[ID]
+	if element == nil {
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*metainfoCacheEntry).Metainfo
+}
+
+func (c *metainfoCache) add(ID string, metainfo *Metainfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element := c.byID[ID]; element != nil {
+		element.Value.(*metainfoCacheEntry).Metainfo = metainfo
+		c.order.MoveToFront(element)
+		return
+	}
+	c.byID[ID] = c.order.PushFront(&metainfoCacheEntry{ID: ID, Metainfo: metainfo})
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.byID, oldest.Value.(*metainfoCacheEntry).ID)
+	}
+}
+
+func (c *diskCache) torrentPath(ID string) string {
+	return filepath.Join(c.dir, "torrents", sanitizeFilename(ID)+".torrent")
+}
+
+func (c *diskCache) saveTorrent(ID string, data []byte) error {
+	path := c.torrentPath(ID)
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	return atomicfile.Write(path, data, 0600)
+}
@@ -0,0 +1,102 @@
+package t411client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dns-gh/t411-client/t411client/t411test"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestMetainfoMagnet(c *C) {
+	metainfo := &Metainfo{
+		InfoHash:     "6cce8f061838512bf171f1e4540fdd090b37b025",
+		Name:         "Série & Co",
+		TotalSize:    1024,
+		AnnounceURLs: []string{"http://tracker.t411.test/announce?passkey=a&b", "udp://tracker.t411.test:80"},
+	}
+	c.Assert(metainfo.Magnet(), Equals, "magnet:?xt=urn:btih:6cce8f061838512bf171f1e4540fdd090b37b025"+
+		"&dn=S%C3%A9rie+%26+Co&xl=1024"+
+		"&tr=http%3A%2F%2Ftracker.t411.test%2Fannounce%3Fpasskey%3Da%26b"+
+		"&tr=udp%3A%2F%2Ftracker.t411.test%3A80")
+}
+
+func (s *MySuite) TestMagnetFor(c *C) {
+	expected, err := ParseMetainfo(t411test.TorrentFile("Vikings.S01E01.HDTV.x264.2HD.VOSTFR"))
+	c.Assert(err, IsNil)
+	dir := c.MkDir()
+	t411 := s.createCachedClient(c, dir, time.Hour)
+	magnet, err := t411.MagnetFor(&Torrent{ID: "4831500"})
+	c.Assert(err, IsNil)
+	c.Assert(magnet, Equals, expected.Magnet())
+	_, err = os.Stat(filepath.Join(dir, "torrents", "4831500.torrent"))
+	c.Assert(err, IsNil)
+
+	// downloaded torrents are reused
+	again, err := t411.MagnetFor(&Torrent{ID: "4831500"})
+	c.Assert(err, IsNil)
+	c.Assert(again, Equals, magnet)
+	c.Assert(s.server.Hits(t411test.TorrentsDownloadAPI), Equals, 1)
+	_, err = t411.DownloadTorrentTo(context.Background(), &Torrent{ID: "4831501"}, &nopWriter{})
+	c.Assert(err, IsNil)
+	_, err = t411.MagnetFor(&Torrent{ID: "4831501"})
+	c.Assert(err, IsNil)
+	c.Assert(s.server.Hits(t411test.TorrentsDownloadAPI), Equals, 2)
+
+	// and so are cached ones
+	t411 = s.createCachedClient(c, dir, time.Hour)
+	again, err = t411.MagnetFor(&Torrent{ID: "4831500"})
+	c.Assert(err, IsNil)
+	c.Assert(again, Equals, magnet)
+	c.Assert(s.server.Hits(t411test.TorrentsDownloadAPI), Equals, 2)
+
+	_, err = t411.MagnetFor(&Torrent{ID: "1"})
+	c.Assert(err, ErrorIs, ErrTorrentNotFound)
+}
+
+type nopWriter struct{}
+
+func (nopWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func (s *MySuite) TestMagnetsFor(c *C) {
+	t411, _, _ := s.createT411Client(c)
+	torrents := &Torrents{Torrents: []Torrent{{ID: "4831500"}, {ID: "1"}, {ID: "4831501"}}}
+	results := t411.MagnetsFor(torrents)
+	c.Assert(results, HasLen, 3)
+	for i, result := range results {
+		c.Assert(result.ID, Equals, torrents.Torrents[i].ID)
+	}
+	c.Assert(results[0].Err, IsNil)
+	c.Assert(results[0].URI, Matches, "magnet:\\?xt=urn:btih:[0-9a-f]{40}&dn=Vikings.S01E01.HDTV.x264.2HD.VOSTFR.mkv&xl=1024&tr=.*")
+	c.Assert(results[1].Err, ErrorIs, ErrTorrentNotFound)
+	c.Assert(results[1].URI, HasLen, 0)
+	c.Assert(results[2].Err, IsNil)
+	c.Assert(results[2].URI, Not(Equals), results[0].URI)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results = t411.MagnetsForContext(ctx, &Torrents{Torrents: []Torrent{{ID: "4831502"}, {ID: "4831503"}}})
+	c.Assert(results, HasLen, 2)
+	for _, result := range results {
+		c.Assert(result.Err, Equals, context.Canceled)
+	}
+}
+
+func (s *MySuite) TestMetainfoCache(c *C) {
+	cache := newMetainfoCache(2)
+	first, second, third := &Metainfo{Name: "first"}, &Metainfo{Name: "second"}, &Metainfo{Name: "third"}
+	cache.add("1", first)
+	cache.add("2", second)
+	c.Assert(cache.get("1"), Equals, first)
+	// the least recently used metainfo is dropped
+	cache.add("3", third)
+	c.Assert(cache.get("2"), IsNil)
+	c.Assert(cache.get("1"), Equals, first)
+	c.Assert(cache.get("3"), Equals, third)
+	cache.add("3", second)
+	c.Assert(cache.get("3"), Equals, second)
+	c.Assert(cache.order.Len(), Equals, 2)
+	c.Assert(cache.byID, HasLen, 2)
+}
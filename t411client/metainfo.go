@@ -0,0 +1,155 @@
+package t411client
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dns-gh/t411-client/t411client/bencode"
+)
+
+// ErrInvalidTorrent is returned when a downloaded torrent file is not a valid
+// metainfo file, for instance an html error page or a truncated file.
+var ErrInvalidTorrent = errors.New("invalid torrent file")
+
+// File represents a file described by a torrent.
+type File struct {
+	// Path is the path of the file inside the torrent, using slashes,
+	// prefixed by the torrent name for multiple files torrents.
+	Path   string
+	Length int64
+}
+
+// Metainfo represents the content of a .torrent file.
+type Metainfo struct {
+	// InfoHash is the hex encoded SHA-1 hash of the info dictionary (BitTorrent v1).
+	InfoHash    string
+	Name        string
+	Files       []File
+	PieceLength int64
+	TotalSize   int64
+	// AnnounceURLs are the tracker urls of 'announce' and 'announce-list', without duplicates.
+	AnnounceURLs []string
+}
+
+func invalidTorrent(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidTorrent, fmt.Sprintf(format, args...))
+}
+
+// ParseMetainfo parses and validates the content of a .torrent file.
+func ParseMetainfo(data []byte) (*Metainfo, error) {
+	root, err := bencode.UnmarshalDict(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTorrent, err)
+	}
+	raw, ok := root["info"]
+	if !ok {
+		return nil, invalidTorrent("missing info dictionary")
+	}
+	decoded, err := bencode.Unmarshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTorrent, err)
+	}
+	info, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, invalidTorrent("info is not a dictionary")
+	}
+	hash := sha1.Sum(raw)
+	m := &Metainfo{
+		InfoHash: hex.EncodeToString(hash[:]),
+	}
+	m.Name, ok = info["name"].(string)
+	if !ok || len(m.Name) == 0 {
+		return nil, invalidTorrent("missing name")
+	}
+	m.PieceLength, ok = info["piece length"].(int64)
+	if !ok || m.PieceLength <= 0 {
+		return nil, invalidTorrent("invalid piece length")
+	}
+	pieces, ok := info["pieces"].(string)
+	if !ok || len(pieces)%sha1.Size != 0 {
+		return nil, invalidTorrent("invalid pieces")
+	}
+	err = m.parseFiles(info)
+	if err != nil {
+		return nil, err
+	}
+	expected := (m.TotalSize + m.PieceLength - 1) / m.PieceLength
+	if int64(len(pieces)/sha1.Size) != expected {
+		return nil, invalidTorrent("%d pieces for %d bytes, expected %d", len(pieces)/sha1.Size, m.TotalSize, expected)
+	}
+	m.parseAnnounceURLs(root)
+	return m, nil
+}
+
+func (m *Metainfo) parseFiles(info map[string]interface{}) error {
+	if length, ok := info["length"]; ok {
+		size, ok := length.(int64)
+		if !ok || size < 0 {
+			return invalidTorrent("invalid length")
+		}
+		m.Files = []File{{Path: m.Name, Length: size}}
+		m.TotalSize = size
+		return nil
+	}
+	files, ok := info["files"].([]interface{})
+	if !ok || len(files) == 0 {
+		return invalidTorrent("missing length or files")
+	}
+	for i, v := range files {
+		file, ok := v.(map[string]interface{})
+		if !ok {
+			return invalidTorrent("file %d is not a dictionary", i)
+		}
+		size, ok := file["length"].(int64)
+		if !ok || size < 0 {
+			return invalidTorrent("invalid length of file %d", i)
+		}
+		path, ok := file["path"].([]interface{})
+		if !ok || len(path) == 0 {
+			return invalidTorrent("invalid path of file %d", i)
+		}
+		elements := []string{m.Name}
+		for _, element := range path {
+			s, ok := element.(string)
+			if !ok {
+				return invalidTorrent("invalid path of file %d", i)
+			}
+			elements = append(elements, s)
+		}
+		m.Files = append(m.Files, File{Path: strings.Join(elements, "/"), Length: size})
+		m.TotalSize += size
+	}
+	return nil
+}
+
+func (m *Metainfo) parseAnnounceURLs(root map[string]bencode.RawMessage) {
+	add := func(v interface{}) {
+		u, ok := v.(string)
+		if !ok || len(u) == 0 {
+			return
+		}
+		for _, known := range m.AnnounceURLs {
+			if known == u {
+				return
+			}
+		}
+		m.AnnounceURLs = append(m.AnnounceURLs, u)
+	}
+	if raw, ok := root["announce"]; ok {
+		announce, _ := bencode.Unmarshal(raw)
+		add(announce)
+	}
+	if raw, ok := root["announce-list"]; ok {
+		list, _ := bencode.Unmarshal(raw)
+		tiers, _ := list.([]interface{})
+		for _, tier := range tiers {
+			urls, _ := tier.([]interface{})
+			for _, u := range urls {
+				add(u)
+			}
+		}
+	}
+}
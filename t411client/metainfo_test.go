@@ -0,0 +1,85 @@
+package t411client
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+
+	"github.com/dns-gh/t411-client/t411client/bencode"
+	. "gopkg.in/check.v1"
+)
+
+func multiFileTorrent(c *C, info map[string]interface{}) []byte {
+	data, err := bencode.Marshal(map[string]interface{}{
+		"announce": "http://tracker.t411.test/announce",
+		"announce-list": []interface{}{
+			[]interface{}{"http://tracker.t411.test/announce", "udp://tracker.t411.test:80"},
+			[]interface{}{"http://backup.t411.test/announce", int64(1)},
+		},
+		"info": info,
+	})
+	c.Assert(err, IsNil)
+	return data
+}
+
+func (s *MySuite) TestParseMetainfo(c *C) {
+	info := map[string]interface{}{
+		"name":         "Vikings.S01",
+		"piece length": int64(1024),
+		"pieces":       strings.Repeat("p", 3*20),
+		"files": []interface{}{
+			map[string]interface{}{"length": int64(2000), "path": []interface{}{"Vikings.S01E01.mkv"}},
+			map[string]interface{}{"length": int64(100), "path": []interface{}{"Subs", "Vikings.S01E01.srt"}},
+		},
+	}
+	encoded, err := bencode.Marshal(info)
+	c.Assert(err, IsNil)
+	hash := sha1.Sum(encoded)
+	metainfo, err := ParseMetainfo(multiFileTorrent(c, info))
+	c.Assert(err, IsNil)
+	c.Assert(metainfo, DeepEquals, &Metainfo{
+		InfoHash: hex.EncodeToString(hash[:]),
+		Name:     "Vikings.S01",
+		Files: []File{
+			{Path: "Vikings.S01/Vikings.S01E01.mkv", Length: 2000},
+			{Path: "Vikings.S01/Subs/Vikings.S01E01.srt", Length: 100},
+		},
+		PieceLength: 1024,
+		TotalSize:   2100,
+		AnnounceURLs: []string{
+			"http://tracker.t411.test/announce",
+			"udp://tracker.t411.test:80",
+			"http://backup.t411.test/announce",
+		},
+	})
+
+	for msg, change := range map[string]func(map[string]interface{}){
+		"missing name":                        func(info map[string]interface{}) { delete(info, "name") },
+		"invalid piece length":                func(info map[string]interface{}) { info["piece length"] = int64(0) },
+		"invalid pieces":                      func(info map[string]interface{}) { info["pieces"] = "short" },
+		"2 pieces for 2100 bytes, expected 3": func(info map[string]interface{}) { info["pieces"] = strings.Repeat("p", 40) },
+		"missing length or files":             func(info map[string]interface{}) { delete(info, "files") },
+		"invalid length":                      func(info map[string]interface{}) { info["length"] = "big" },
+		"file 0 is not a dictionary":          func(info map[string]interface{}) { info["files"] = []interface{}{"file"} },
+		"invalid path of file 0": func(info map[string]interface{}) {
+			info["files"] = []interface{}{map[string]interface{}{"length": int64(1)}}
+		},
+		"invalid length of file 0": func(info map[string]interface{}) {
+			info["files"] = []interface{}{map[string]interface{}{"path": []interface{}{"a"}}}
+		},
+	} {
+		broken := map[string]interface{}{}
+		for k, v := range info {
+			broken[k] = v
+		}
+		change(broken)
+		_, err = ParseMetainfo(multiFileTorrent(c, broken))
+		c.Assert(err, ErrorIs, ErrInvalidTorrent)
+		c.Assert(err, ErrorMatches, "invalid torrent file: "+msg)
+	}
+
+	for _, data := range []string{"", "<html></html>", "d8:announce3:urle", "d4:infoi1ee", "d4:infod4:name"} {
+		_, err = ParseMetainfo([]byte(data))
+		c.Assert(err, ErrorIs, ErrInvalidTorrent, Commentf("data %q", data))
+	}
+}
@@ -0,0 +1,125 @@
+package t411client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// getBaseURL returns the base url currently used by the client.
+func (t *T411) getBaseURL() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.baseURL
+}
+
+// switchMirror replaces the base url 'from' with 'to' unless
+// another request has already switched it in the meantime.
+func (t *T411) switchMirror(from, to string) {
+	t.mu.Lock()
+	switched := strings.TrimSuffix(t.baseURL, "/") == from
+	if switched {
+		t.baseURL = to
+	}
+	t.mu.Unlock()
+	if !switched {
+		return
+	}
+	t.logger.Printf("Switching t411 API base url from %s to %s", from, to)
+	if t.onMirrorSwitch != nil {
+		t.onMirrorSwitch(from, to)
+	}
+}
+
+// mirrorOf returns the index of the mirror requested by 'u', -1 if none.
+func (t *T411) mirrorOf(u *url.URL) int {
+	for i, baseURL := range t.mirrors {
+		if u.String() == baseURL || strings.HasPrefix(u.String(), baseURL+"/") {
+			return i
+		}
+	}
+	return -1
+}
+
+// isDeadMirror reports whether the request failed because the mirror is dead,
+// that is its domain cannot be resolved, its certificate is invalid or it
+// refuses connections, or because it has moved, that is it redirects to
+// another host or serves an html page instead of the API.
+func isDeadMirror(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		var dnsErr *net.DNSError
+		return errors.As(err, &dnsErr) ||
+			isTLSFailure(err) ||
+			errors.Is(err, syscall.ECONNREFUSED)
+	}
+	if resp.Request != nil && resp.Request.URL.Host != req.URL.Host {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return resp.StatusCode == http.StatusOK && mediaType == "text/html"
+}
+
+// isTLSFailure reports whether the error comes from a server not speaking
+// TLS or from a certificate that cannot be verified, which does not fix itself.
+func isTLSFailure(err error) bool {
+	var recordErr tls.RecordHeaderError
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &recordErr) ||
+		errors.As(err, &verifyErr) ||
+		errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr)
+}
+
+// doMirrored sends the request, failing over to the next mirrors in
+// order if the requested one is dead. The first working mirror
+// replaces the base url of the client.
+func (t *T411) doMirrored(req *http.Request) (*http.Response, error) {
+	resp, err := t.httpClient.Do(req)
+	current := t.mirrorOf(req.URL)
+	if current < 0 || !isDeadMirror(req, resp, err) || req.Context().Err() != nil {
+		return resp, err
+	}
+	from := t.mirrors[current]
+	path := strings.TrimPrefix(req.URL.String(), from)
+	for i := 1; i < len(t.mirrors); i++ {
+		t.logger.Printf("t411 API mirror %s looks dead: %s", t.mirrors[(current+i-1)%len(t.mirrors)], describeFailure(resp, err))
+		if resp != nil {
+			resp.Body.Close()
+		}
+		to := t.mirrors[(current+i)%len(t.mirrors)]
+		next, rewindErr := rewindRequest(req)
+		if rewindErr != nil {
+			return nil, err
+		}
+		next.URL, rewindErr = url.Parse(to + path)
+		if rewindErr != nil {
+			return nil, err
+		}
+		next.Host = ""
+		// the cache validators are those of the response of the dead mirror
+		next.Header.Del("If-None-Match")
+		next.Header.Del("If-Modified-Since")
+		resp, err = t.httpClient.Do(next)
+		if !isDeadMirror(next, resp, err) {
+			t.switchMirror(from, to)
+			return resp, err
+		}
+		if next.Context().Err() != nil {
+			break
+		}
+	}
+	if resp != nil && err == nil {
+		return resp, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,110 @@
+package t411client
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/dns-gh/t411-client/t411client/t411test"
+	. "gopkg.in/check.v1"
+)
+
+const deadURL = "http://127.0.0.1:1"
+
+func (s *MySuite) TestMirrors(c *C) {
+	switches := []string{}
+	onSwitch := func(from, to string) {
+		switches = append(switches, fmt.Sprintf("%s -> %s", from, to))
+	}
+	other := t411test.NewServer()
+	defer other.Close()
+	seedServer(other)
+	t411, err := New(
+		WithBaseURL(deadURL),
+		WithCredentials(testUsername, testPassword),
+		WithMirrors(s.server.URL, other.URL),
+		WithMirrorSwitch(onSwitch),
+		WithRetryPolicy(fastRetryPolicy),
+	)
+	c.Assert(err, IsNil)
+	c.Assert(switches, DeepEquals, []string{deadURL + " -> " + s.server.URL})
+	c.Assert(t411.getBaseURL(), Equals, s.server.URL)
+
+	// the working mirror is remembered
+	checkUser(c, t411, testUsername)
+	_, err = t411.Search(NewSearchQuery("vikings"))
+	c.Assert(err, IsNil)
+	c.Assert(switches, HasLen, 1)
+	c.Assert(s.server.Hits(t411test.UsersProfileAPI), Equals, 1)
+
+	// mirrors are tried in order from the current one
+	s.server.Close()
+	checkUser(c, t411, testUsername)
+	c.Assert(switches, DeepEquals, []string{
+		deadURL + " -> " + s.server.URL,
+		s.server.URL + " -> " + other.URL,
+	})
+	c.Assert(t411.getBaseURL(), Equals, other.URL)
+
+	// an error is returned when every mirror is dead
+	other.Close()
+	_, err = t411.UsersProfile("12345")
+	c.Assert(err, NotNil)
+	c.Assert(switches, HasLen, 2)
+}
+
+func (s *MySuite) TestMovedMirror(c *C) {
+	parking := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<html><body>This domain is for sale!</body></html>")
+	}))
+	defer parking.Close()
+	moved := httptest.NewServer(http.RedirectHandler(parking.URL, http.StatusFound))
+	defer moved.Close()
+
+	switches := []string{}
+	t411, err := New(
+		WithBaseURL(moved.URL+"/"),
+		WithCredentials(testUsername, testPassword),
+		WithMirrors(parking.URL, s.server.URL),
+		WithMirrorSwitch(func(from, to string) {
+			switches = append(switches, fmt.Sprintf("%s -> %s", from, to))
+		}),
+	)
+	c.Assert(err, IsNil)
+	c.Assert(switches, DeepEquals, []string{moved.URL + " -> " + s.server.URL})
+	categories, err := t411.CategoriesTree()
+	c.Assert(err, IsNil)
+	checkCategories(c, categories.Categories)
+
+	// without mirrors, requests are not changed
+	_, err = New(WithBaseURL(parking.URL), WithCredentials(testUsername, testPassword))
+	c.Assert(err, NotNil)
+}
+
+func (s *MySuite) TestIsDeadMirror(c *C) {
+	req, err := http.NewRequest("GET", "https://api.t411.test/auth", nil)
+	c.Assert(err, IsNil)
+	for _, err := range []error{
+		&url.Error{Op: "Get", URL: req.URL.String(), Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "api.t411.test"}}},
+		&url.Error{Op: "Get", URL: req.URL.String(), Err: x509.UnknownAuthorityError{}},
+		&url.Error{Op: "Get", URL: req.URL.String(), Err: x509.HostnameError{Host: "api.t411.test"}},
+	} {
+		c.Assert(isDeadMirror(req, nil, err), Equals, true, Commentf("%v", err))
+	}
+	c.Assert(isDeadMirror(req, nil, errors.New("connection reset by peer")), Equals, false)
+
+	resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}, Request: req}
+	resp.Header.Set("Content-Type", "text/html")
+	c.Assert(isDeadMirror(req, resp, nil), Equals, false)
+	resp.StatusCode = http.StatusOK
+	c.Assert(isDeadMirror(req, resp, nil), Equals, true)
+	resp.Header.Set("Content-Type", "application/json")
+	c.Assert(isDeadMirror(req, resp, nil), Equals, false)
+	resp.Request = &http.Request{URL: &url.URL{Scheme: "https", Host: "parking.test"}}
+	c.Assert(isDeadMirror(req, resp, nil), Equals, true)
+}
@@ -0,0 +1,325 @@
+package t411client
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout     = 10 * time.Second
+	defaultDialTimeout = 5 * time.Second
+	// defaultMaxRetryAfter is the default maximum Retry-After delay waited for.
+	defaultMaxRetryAfter = 30 * time.Second
+	defaultFileMode      = 0644
+)
+
+// Logger is the interface used by the T411 client to log messages.
+// It is implemented by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+type options struct {
+	baseURL      string
+	credentials  Credentials
+	httpClient   *http.Client
+	transport    http.RoundTripper
+	userAgent    string
+	timeout      time.Duration
+	dialTimeout  time.Duration
+	logger       Logger
+	token        string
+	tokenStore   TokenStore
+	maxDelay     float64
+	keepRatio    bool
+	onlyVerified bool
+	termsTTL     time.Duration
+	cacheDir     string
+	cacheTTL     time.Duration
+	rateLimit    RateLimit
+	// endpointRateLimits are the rate limits by endpoint
+	endpointRateLimits map[string]RateLimit
+	maxRetryAfter      time.Duration
+	retry              RetryPolicy
+	mirrors            []string
+	onMirrorSwitch     func(from, to string)
+	fileMode           os.FileMode
+	collision          CollisionPolicy
+	ranker             Ranker
+}
+
+// Option configures a T411 client created with New.
+type Option func(*options)
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		baseURL:            t411BaseURL,
+		userAgent:          UserAgent,
+		timeout:            defaultTimeout,
+		dialTimeout:        defaultDialTimeout,
+		logger:             log.Default(),
+		maxDelay:           defaultDelay,
+		keepRatio:          true,
+		onlyVerified:       false,
+		endpointRateLimits: map[string]RateLimit{},
+		maxRetryAfter:      defaultMaxRetryAfter,
+		retry:              DefaultRetryPolicy,
+		fileMode:           defaultFileMode,
+		collision:          CollisionOverwrite,
+		ranker:             DefaultRanker,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithBaseURL sets the base url of the t411 API. A trailing slash is ignored.
+// The default one is kept if 'baseURL' is empty.
+func WithBaseURL(baseURL string) Option {
+	return func(o *options) {
+		if len(baseURL) != 0 {
+			o.baseURL = baseURL
+		}
+	}
+}
+
+// WithCredentials sets the credentials used to retrieve tokens.
+func WithCredentials(username, password string) Option {
+	return func(o *options) {
+		o.credentials = Credentials{
+			Username: username,
+			Password: password,
+		}
+	}
+}
+
+// WithHTTPClient sets the http client used to do the requests.
+// It takes precedence over WithTransport, WithTimeout and WithDialTimeout.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithTransport sets the round tripper of the default http client.
+// It takes precedence over WithDialTimeout.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+// WithUserAgent sets the user agent header used in http requests.
+// By default, UserAgent is used.
+func WithUserAgent(userAgent string) Option {
+	return func(o *options) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithTimeout sets the time limit of the requests done by the default http client.
+// By default, it is set to 10 seconds.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithDialTimeout sets the connection and TLS handshake time limits
+// of the default http transport. By default, they are set to 5 seconds.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithLogger sets the logger used by the client.
+// By default, the standard logger of the log package is used.
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithToken sets a token from a previous session to use instead of retrieving
+// a new one. It must be of the form 12345:123:abcdefghijklmnopqr.
+func WithToken(token string) Option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+// WithTokenStore sets the store used to persist tokens across sessions.
+// Unless a token is set with WithToken, the token saved in the store is used
+// at creation and every newly retrieved token is saved in the store.
+func WithTokenStore(store TokenStore) Option {
+	return func(o *options) {
+		o.tokenStore = store
+	}
+}
+
+// WithMaxDelay sets the maximum delay in hours. See SetMaxDelay.
+func WithMaxDelay(maxDelay float64) Option {
+	return func(o *options) {
+		o.maxDelay = maxDelay
+	}
+}
+
+// WithKeepRatio enables or disables the ratio guard. See KeepRatio.
+func WithKeepRatio(keepRatio bool) Option {
+	return func(o *options) {
+		o.keepRatio = keepRatio
+	}
+}
+
+// WithOnlyVerified enables or disables the verified only mode. See OnlyVerified.
+func WithOnlyVerified(onlyVerified bool) Option {
+	return func(o *options) {
+		o.onlyVerified = onlyVerified
+	}
+}
+
+// WithTermResolver makes the client resolve the season, episode, language
+// and quality term ids from the terms tree of the API, caching them for 'ttl'.
+// By default, or if 'ttl' is not positive, the built-in term ids are used.
+// See TermResolver.
+func WithTermResolver(ttl time.Duration) Option {
+	return func(o *options) {
+		o.termsTTL = ttl
+	}
+}
+
+// WithCache makes the client cache the categories and terms trees in the
+// directory 'dir', which is created if needed, separately for each base url
+// so that clients of different APIs can share the directory. Cached trees are served without
+// any request for 'ttl' and are then revalidated using the ETag and Last-Modified
+// headers of the previous response. Expired trees are still served if the API
+// cannot be reached. By default, the trees are not cached.
+func WithCache(dir string, ttl time.Duration) Option {
+	return func(o *options) {
+		o.cacheDir = dir
+		o.cacheTTL = ttl
+	}
+}
+
+// WithRateLimit limits the rate of all the requests done by the client.
+// By default, requests are not limited.
+func WithRateLimit(limit RateLimit) Option {
+	return func(o *options) {
+		o.rateLimit = limit
+	}
+}
+
+// WithEndpointRateLimit limits the rate of the requests done to 'endpoint',
+// one of the Endpoint constants, on top of the limit set with WithRateLimit.
+func WithEndpointRateLimit(endpoint string, limit RateLimit) Option {
+	return func(o *options) {
+		o.endpointRateLimits[endpoint] = limit
+	}
+}
+
+// WithMaxRetryAfter sets the longest delay requested by a Retry-After header
+// that the client waits for before sending a throttled request again.
+// Requests asked to wait longer fail with ErrThrottled. By default, it is set to 30 seconds.
+func WithMaxRetryAfter(delay time.Duration) Option {
+	return func(o *options) {
+		o.maxRetryAfter = delay
+	}
+}
+
+// WithRetryPolicy sets how GET requests failing transiently are retried.
+// By default, DefaultRetryPolicy is used. A zero RetryPolicy disables retries.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = policy
+	}
+}
+
+// WithMirrors sets the base urls of the mirrors of the t411 API, tried in order
+// after the base url when it is dead or has moved. The client keeps using
+// the first working one until it fails in turn. See WithMirrorSwitch.
+func WithMirrors(baseURLs ...string) Option {
+	return func(o *options) {
+		o.mirrors = append(o.mirrors, baseURLs...)
+	}
+}
+
+// WithMirrorSwitch sets a function called whenever the client
+// fails over from the base url 'from' to the mirror 'to'.
+func WithMirrorSwitch(onSwitch func(from, to string)) Option {
+	return func(o *options) {
+		o.onMirrorSwitch = onSwitch
+	}
+}
+
+// WithFileMode sets the permissions of the torrent files written by
+// DownloadTorrent and DownloadTorrentToDir. By default, they are set to 0644.
+func WithFileMode(mode os.FileMode) Option {
+	return func(o *options) {
+		o.fileMode = mode
+	}
+}
+
+// WithCollisionPolicy sets what to do when a torrent file is downloaded into
+// a directory where a file with the same name already exists.
+// By default, the existing file is overwritten.
+func WithCollisionPolicy(policy CollisionPolicy) Option {
+	return func(o *options) {
+		o.collision = policy
+	}
+}
+
+// WithRanker sets the ranker choosing the torrent downloaded by DownloadTorrentByTerms.
+// By default, the torrent with the most seeders is chosen, see DefaultRanker.
+// The default ranker is kept if 'ranker' is nil.
+func WithRanker(ranker Ranker) Option {
+	return func(o *options) {
+		if ranker != nil {
+			o.ranker = ranker
+		}
+	}
+}
+
+// mirrorList returns the base url followed by the mirrors, without duplicates.
+func (o *options) mirrorList() []string {
+	if len(o.mirrors) == 0 {
+		return nil
+	}
+	list := []string{}
+	for _, baseURL := range append([]string{o.baseURL}, o.mirrors...) {
+		baseURL = strings.TrimSuffix(baseURL, "/")
+		found := false
+		for _, v := range list {
+			found = found || v == baseURL
+		}
+		if !found && len(baseURL) != 0 {
+			list = append(list, baseURL)
+		}
+	}
+	return list
+}
+
+func (o *options) newHTTPClient() *http.Client {
+	if o.httpClient != nil {
+		return o.httpClient
+	}
+	transport := o.transport
+	if transport == nil {
+		transport = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			Dial: (&net.Dialer{
+				Timeout: o.dialTimeout,
+			}).Dial,
+			TLSHandshakeTimeout: o.dialTimeout,
+		}
+	}
+	return &http.Client{
+		Timeout:   o.timeout,
+		Transport: transport,
+	}
+}
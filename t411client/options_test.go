@@ -0,0 +1,64 @@
+package t411client
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dns-gh/t411-client/t411client/t411test"
+	. "gopkg.in/check.v1"
+)
+
+type recordingTransport struct {
+	userAgents []string
+}
+
+func (r *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.userAgents = append(r.userAgents, req.Header.Get("User-Agent"))
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (s *MySuite) TestNewWithOptions(c *C) {
+	transport := &recordingTransport{}
+	buffer := &bytes.Buffer{}
+	t411, err := New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithTransport(transport),
+		WithUserAgent("MyBot"),
+		WithTimeout(time.Second),
+		WithLogger(log.New(buffer, "", 0)),
+		WithMaxDelay(48),
+		WithKeepRatio(false),
+		WithOnlyVerified(true),
+	)
+	c.Assert(err, IsNil)
+	c.Assert(t411.httpClient.Timeout, Equals, time.Second)
+	c.Assert(t411.GetMaxDelay(), Equals, float64(48))
+	c.Assert(t411.isKeepingRatio(), Equals, false)
+	c.Assert(t411.isOnlyVerified(), Equals, true)
+
+	s.server.ExpireTokens()
+	checkUser(c, t411, testUsername)
+	c.Assert(transport.userAgents, DeepEquals, []string{"MyBot", "MyBot", "MyBot", "MyBot"})
+	c.Assert(buffer.String(), Equals, "Token has something wrong: 201: Token has expired. Please login\n")
+
+	token, err := t411.GetToken()
+	c.Assert(err, IsNil)
+	httpClient := &http.Client{}
+	t411, err = New(
+		WithBaseURL(s.server.URL),
+		WithHTTPClient(httpClient),
+		WithTransport(transport),
+		WithToken(token),
+	)
+	c.Assert(err, IsNil)
+	c.Assert(t411.httpClient, Equals, httpClient)
+	c.Assert(s.server.Hits(t411test.AuthAPI), Equals, 2)
+
+	_, err = New(WithBaseURL(s.server.URL), WithToken("invalid"))
+	c.Assert(err, Equals, ErrInvalidTokenFormat)
+	_, err = New(WithBaseURL(s.server.URL))
+	c.Assert(err, ErrorIs, ErrUserNotFound)
+}
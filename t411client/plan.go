@@ -0,0 +1,133 @@
+package t411client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Filters applied by DownloadTorrentByTerms, in order, see PlanEntry.
+const (
+	// NameFilter rejects the torrents whose name does not contain all the words of the title.
+	NameFilter = "name"
+	// DateFilter rejects the torrents not added shortly after the date, see SetMaxDelay.
+	DateFilter = "date"
+	// PartFilter rejects the parts of a season when searching for a whole season.
+	PartFilter = "part"
+	// VerifiedFilter rejects the torrents that are not verified if only
+	// verified torrents are downloaded, see OnlyVerified.
+	VerifiedFilter = "verified"
+)
+
+// PlanEntry represents a torrent returned by the search of PlanDownload.
+type PlanEntry struct {
+	Torrent Torrent
+	// RejectedBy is the filter that rejected the torrent, empty if the torrent was kept.
+	RejectedBy string
+	// Reason explains why the torrent was rejected.
+	Reason string
+}
+
+// DownloadPlan represents what DownloadTorrentByTerms would download.
+type DownloadPlan struct {
+	// Entries are all the torrents returned by the search, in order.
+	Entries []PlanEntry
+	// Ranker is the name of the ranker ordering the torrents kept by the filters.
+	Ranker string
+	// Candidates are the torrents kept by the filters, best first.
+	Candidates []Candidate
+	// Pick is the torrent that would be downloaded, nil if none was kept.
+	Pick *Torrent
+}
+
+// PlanDownload runs the search, the filters and the ranking of DownloadTorrentByTerms
+// without downloading anything and reports why each torrent was rejected or kept.
+// No error is returned when no torrent is left, Pick is nil instead.
+// The verified check of DownloadTorrent is run as a filter but not the ratio
+// check, which requests the user profile, so the download of Pick may still fail
+// with ErrKeepRatio.
+func (t *T411) PlanDownload(title string, season, episode int, language, quality, date string) (*DownloadPlan, error) {
+	return t.PlanDownloadContext(context.Background(), title, season, episode, language, quality, date)
+}
+
+// PlanDownloadContext does the same as PlanDownload using the
+// provided context for the underlying http requests.
+func (t *T411) PlanDownloadContext(ctx context.Context, title string, season, episode int, language, quality, date string) (*DownloadPlan, error) {
+	// filter by name first since pending torrents can have
+	// field Name empty so we check that first.
+	filters := []torrentFilter{t.filterByName(title)}
+	if len(date) != 0 {
+		filter, err := t.filterByDate(date)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	if season != 0 && episode == 0 {
+		filters = append(filters, t.filterByPart())
+	}
+	filters = append(filters, t.filterByVerified())
+	torrents, err := t.SearchTorrentsByTermsContext(ctx, title, season, episode, language, quality, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	plan := &DownloadPlan{
+		Entries: make([]PlanEntry, 0, len(torrents.Torrents)),
+		Ranker:  t.ranker.Name(),
+	}
+	kept := []Torrent{}
+	for _, torrent := range torrents.Torrents {
+		entry := PlanEntry{
+			Torrent: torrent,
+		}
+		for _, filter := range filters {
+			reason := filter.reject(&torrent)
+			if len(reason) != 0 {
+				entry.RejectedBy = filter.name
+				entry.Reason = reason
+				break
+			}
+		}
+		if len(entry.RejectedBy) == 0 {
+			kept = append(kept, torrent)
+		}
+		plan.Entries = append(plan.Entries, entry)
+	}
+	plan.Candidates = t.ranker.Rank(kept)
+	if len(plan.Candidates) != 0 {
+		pick := plan.Candidates[0].Torrent
+		plan.Pick = &pick
+	}
+	return plan, nil
+}
+
+// String returns a human readable report of the plan listing the
+// candidates, best first, followed by the rejected torrents.
+func (p *DownloadPlan) String() string {
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, "%d torrents found, %d rejected, ranked by '%s'\n",
+		len(p.Entries), len(p.Entries)-len(p.Candidates), p.Ranker)
+	for i, candidate := range p.Candidates {
+		fmt.Fprintf(buffer, "%s '%s': score %.3f", candidate.Torrent.ID, candidate.Torrent.Name, candidate.Score)
+		names := make([]string, 0, len(candidate.Scores))
+		for name := range candidate.Scores {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(buffer, ", %s %.3f", name, candidate.Scores[name])
+		}
+		if i == 0 {
+			buffer.WriteString(", picked")
+		}
+		buffer.WriteString("\n")
+	}
+	for _, entry := range p.Entries {
+		if len(entry.RejectedBy) != 0 {
+			fmt.Fprintf(buffer, "%s '%s': rejected by %s filter, %s\n",
+				entry.Torrent.ID, entry.Torrent.Name, entry.RejectedBy, entry.Reason)
+		}
+	}
+	return buffer.String()
+}
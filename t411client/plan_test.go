@@ -0,0 +1,96 @@
+package t411client
+
+import (
+	"os"
+
+	"github.com/dns-gh/t411-client/t411client/t411test"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestPlanDownload(c *C) {
+	s.server.AddTorrent(t411test.Torrent{ID: "4000004", Name: "Stargate.SG-1.S01.Part.2.FRENCH", Seeders: "50", TermIDs: []int{968, 936}})
+	t411, _, _ := s.createT411Client(c)
+	plan, err := t411.PlanDownload("stargate", 1, 0, "", "", "")
+	c.Assert(err, IsNil)
+	c.Assert(plan.Entries, HasLen, 2)
+	c.Assert(plan.Entries[0].RejectedBy, HasLen, 0)
+	c.Assert(plan.Entries[1].Torrent.ID, Equals, "4000004")
+	c.Assert(plan.Entries[1].RejectedBy, Equals, PartFilter)
+	c.Assert(plan.Entries[1].Reason, Equals, "name contains '.part.'")
+	c.Assert(plan.Candidates, HasLen, 1)
+	c.Assert(plan.Pick.ID, Equals, "4000001")
+	c.Assert(plan.String(), Equals, `2 torrents found, 1 rejected, ranked by 'seeders'
+4000001 'Stargate.SG-1.S01.FRENCH.DVDRip.XviD': score 0.333, seeders 0.333, picked
+4000004 'Stargate.SG-1.S01.Part.2.FRENCH': rejected by part filter, name contains '.part.'
+`)
+	c.Assert(s.server.Hits(t411test.TorrentsDownloadAPI), Equals, 0)
+
+	// torrents without any added date are rejected by the date filter
+	plan, err = t411.PlanDownload("stargate", 1, 0, "", "", "2013-03-01")
+	c.Assert(err, IsNil)
+	for _, entry := range plan.Entries {
+		c.Assert(entry.RejectedBy, Equals, DateFilter)
+		c.Assert(entry.Reason, Equals, "no added date")
+	}
+	c.Assert(plan.Candidates, HasLen, 0)
+	c.Assert(plan.Pick, IsNil)
+
+	t411.SetMaxDelay(24 * 7)
+	plan, err = t411.PlanDownload("vikings", 1, 1, "", "", "2013-03-01")
+	c.Assert(err, IsNil)
+	c.Assert(plan.Entries, HasLen, 10)
+	c.Assert(plan.Candidates, HasLen, 10)
+	c.Assert(plan.Pick.ID, Equals, "4831501")
+	plan, err = t411.PlanDownload("vikings", 1, 1, "", "", "2013-02-01")
+	c.Assert(err, IsNil)
+	c.Assert(plan.Entries, HasLen, 10)
+	c.Assert(plan.Entries[0].RejectedBy, Equals, DateFilter)
+	c.Assert(plan.Entries[0].Reason, Equals, "added on 2013-03-04 10:00:00, not within 168h after 2013-02-01")
+	c.Assert(plan.Pick, IsNil)
+	_, err = t411.DownloadTorrentByTerms("vikings", 1, 1, "", "", "2013-02-01")
+	c.Assert(err, ErrorIs, ErrTorrentNotFound)
+
+	// invalid dates are detected before searching
+	hits := s.server.Hits(t411test.TorrentsSearchAPI)
+	_, err = t411.PlanDownload("vikings", 1, 1, "", "", "01/03/2013")
+	c.Assert(err, NotNil)
+	c.Assert(s.server.Hits(t411test.TorrentsSearchAPI), Equals, hits)
+	c.Assert(s.server.Hits(t411test.TorrentsDownloadAPI), Equals, 0)
+}
+
+func (s *MySuite) TestPlanDownloadOnlyVerified(c *C) {
+	s.server.AddTorrent(t411test.Torrent{ID: "4000005", Name: "Stargate.SG-1.S01.MULTI.DVDRip", Seeders: "50", IsVerified: "0", TermIDs: []int{968, 936}})
+	t411, _, _ := s.createT411Client(c)
+	plan, err := t411.PlanDownload("stargate", 1, 0, "", "", "")
+	c.Assert(err, IsNil)
+	c.Assert(plan.Pick.ID, Equals, "4000005")
+
+	// the pick can be downloaded in verified only mode
+	t411.OnlyVerified(true)
+	plan, err = t411.PlanDownload("stargate", 1, 0, "", "", "")
+	c.Assert(err, IsNil)
+	c.Assert(plan.Entries, HasLen, 2)
+	c.Assert(plan.Entries[1].Torrent.ID, Equals, "4000005")
+	c.Assert(plan.Entries[1].RejectedBy, Equals, VerifiedFilter)
+	c.Assert(plan.Entries[1].Reason, Equals, ErrNotVerified.Error())
+	c.Assert(plan.Candidates, HasLen, 1)
+	c.Assert(plan.Pick.ID, Equals, "4000001")
+	c.Assert(plan.String(), Equals, `2 torrents found, 1 rejected, ranked by 'seeders'
+4000001 'Stargate.SG-1.S01.FRENCH.DVDRip.XviD': score 0.333, seeders 0.333, picked
+4000005 'Stargate.SG-1.S01.MULTI.DVDRip': rejected by verified filter, cannot download non-verified torrent
+`)
+	path, err := t411.DownloadTorrentByTerms("stargate", 1, 0, "", "", "")
+	c.Assert(err, IsNil)
+	c.Assert(os.Remove(path), IsNil)
+	c.Assert(s.server.Hits(t411test.TorrentsDownloadAPI), Equals, 1)
+}
+
+func (s *MySuite) TestFilterByName(c *C) {
+	t411, _, _ := s.createT411Client(c)
+	filter := t411.filterByName("Vikings (2013)")
+	c.Assert(filter.name, Equals, NameFilter)
+	c.Assert(filter.reject(&Torrent{Name: "Vikings.2013.S01E01"}), Equals, "")
+	c.Assert(filter.reject(&Torrent{Name: "Vikings.2014.S01E01"}), Equals, "name does not contain '2013'")
+	// pending torrents have no name
+	c.Assert(filter.reject(&Torrent{}), Equals, "name does not contain 'vikings'")
+}
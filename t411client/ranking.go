@@ -0,0 +1,253 @@
+package t411client
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// seedersHalfScore is the number of seeders scoring 0.5 with SeedersScorer.
+const seedersHalfScore = 10
+
+// Scorer scores one aspect of a torrent, from 0 for the worst to 1 for the best.
+// The scorers of this package read the typed Values of the torrents, parsing
+// the raw fields when Values is unset as for torrents built by hand.
+type Scorer interface {
+	Score(torrent *Torrent) float64
+}
+
+// ScorerFunc is an adapter allowing the use of ordinary functions as Scorer.
+type ScorerFunc func(torrent *Torrent) float64
+
+// Score implements the Scorer interface.
+func (f ScorerFunc) Score(torrent *Torrent) float64 {
+	return f(torrent)
+}
+
+// Candidate represents a torrent scored by a Ranker.
+type Candidate struct {
+	Torrent Torrent
+	// Score is the overall score of the torrent, the higher the better.
+	Score float64
+	// Scores are the unweighted scores of the torrent by scorer name.
+	Scores map[string]float64
+}
+
+// Ranker orders the candidates of DownloadTorrentByTerms,
+// the first candidate returned by Rank being downloaded.
+type Ranker interface {
+	Name() string
+	Rank(torrents []Torrent) []Candidate
+}
+
+// WeightedScorer is a named Scorer and its weight in a WeightedRanker.
+type WeightedScorer struct {
+	Name   string
+	Weight float64
+	Scorer Scorer
+}
+
+// WeightedRanker is a Ranker ordering the torrents by the weighted sum
+// of the scores of its scorers. Torrents with equal scores are ordered
+// by seeders and keep their order otherwise.
+type WeightedRanker struct {
+	name    string
+	scorers []WeightedScorer
+}
+
+// DefaultRanker is the Ranker used by default, it picks the torrent with the most seeders.
+var DefaultRanker Ranker = NewWeightedRanker("seeders", WeightedScorer{Name: "seeders", Weight: 1, Scorer: SeedersScorer()})
+
+// NewWeightedRanker creates a WeightedRanker named 'name' combining the given scorers.
+func NewWeightedRanker(name string, scorers ...WeightedScorer) *WeightedRanker {
+	return &WeightedRanker{
+		name:    name,
+		scorers: scorers,
+	}
+}
+
+// Name implements the Ranker interface.
+func (r *WeightedRanker) Name() string {
+	return r.name
+}
+
+// Rank implements the Ranker interface.
+func (r *WeightedRanker) Rank(torrents []Torrent) []Candidate {
+	candidates := make([]Candidate, 0, len(torrents))
+	for _, torrent := range torrents {
+		candidate := Candidate{
+			Torrent: torrent,
+			Scores:  map[string]float64{},
+		}
+		for _, scorer := range r.scorers {
+			score := scorer.Scorer.Score(&torrent)
+			candidate.Scores[scorer.Name] = score
+			candidate.Score += scorer.Weight * score
+		}
+		candidates = append(candidates, candidate)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return lessSeeders(&candidates[j].Torrent, &candidates[i].Torrent)
+	})
+	return candidates
+}
+
+// SeedersScorer scores the torrents by number of seeders,
+// 10 seeders scoring 0.5 and the score tending to 1.
+func SeedersScorer() Scorer {
+	return ScorerFunc(func(torrent *Torrent) float64 {
+		values, _ := torrent.values()
+		seeders := float64(values.Seeders)
+		if seeders <= 0 {
+			return 0
+		}
+		return seeders / (seeders + seedersHalfScore)
+	})
+}
+
+// LeechersRatioScorer scores the torrents by the proportion of seeders
+// among the peers, torrents without any seeder scoring 0.
+func LeechersRatioScorer() Scorer {
+	return ScorerFunc(func(torrent *Torrent) float64 {
+		values, _ := torrent.values()
+		seeders, leechers := values.Seeders, values.Leechers
+		if seeders <= 0 {
+			return 0
+		}
+		if leechers < 0 {
+			leechers = 0
+		}
+		return float64(seeders) / float64(seeders+leechers)
+	})
+}
+
+// SizeScorer scores 1 the torrents whose size in bytes is between 'min'
+// and 'max' included and 0 the others. There is no upper bound if 'max' is 0.
+func SizeScorer(min, max int64) Scorer {
+	return ScorerFunc(func(torrent *Torrent) float64 {
+		values, _ := torrent.values()
+		size := values.Size
+		if size < min || max > 0 && size > max {
+			return 0
+		}
+		return 1
+	})
+}
+
+// QualityScorer scores the torrents by the preferred qualities, in order,
+// matched case-insensitively against the resolution, the source and the
+// codec of the release name, see ParseRelease. The first quality scores 1,
+// the next ones less and the torrents matching none of them 0.
+func QualityScorer(qualities ...string) Scorer {
+	return ScorerFunc(func(torrent *Torrent) float64 {
+		release := torrent.Release()
+		return preferenceScore(qualities, release.Resolution, release.Source, release.Codec)
+	})
+}
+
+// LanguageScorer scores the torrents by the preferred language tags, in order,
+// like 'VOSTFR' or 'MULTI', matched case-insensitively against the release name,
+// see ParseRelease. The first language scores 1, the next ones less and the
+// torrents matching none of them 0.
+func LanguageScorer(languages ...string) Scorer {
+	return ScorerFunc(func(torrent *Torrent) float64 {
+		return preferenceScore(languages, torrent.Release().Languages...)
+	})
+}
+
+// preferenceScore returns 1 if one of the values matches the first preference,
+// decreasing linearly with the rank of the best matching preference.
+func preferenceScore(preferences []string, values ...string) float64 {
+	for i, preference := range preferences {
+		for _, value := range values {
+			if len(value) != 0 && strings.EqualFold(preference, value) {
+				return float64(len(preferences)-i) / float64(len(preferences))
+			}
+		}
+	}
+	return 0
+}
+
+// VerifiedScorer scores 1 the verified torrents and 0 the others.
+func VerifiedScorer() Scorer {
+	return ScorerFunc(func(torrent *Torrent) float64 {
+		if values, _ := torrent.values(); values.IsVerified {
+			return 1
+		}
+		return 0
+	})
+}
+
+// RecencyScorer scores the torrents by age, a torrent added now scoring 1
+// and the score being halved every 'halfLife'. Torrents without any added
+// date score 0.
+func RecencyScorer(halfLife time.Duration) Scorer {
+	return ScorerFunc(func(torrent *Torrent) float64 {
+		values, _ := torrent.values()
+		if values.Added.IsZero() || halfLife <= 0 {
+			return 0
+		}
+		age := time.Since(values.Added)
+		if age < 0 {
+			return 1
+		}
+		return math.Pow(0.5, float64(age)/float64(halfLife))
+	})
+}
+
+// UploaderScorer scores 1 the torrents uploaded by one of the
+// given usernames, compared case-insensitively, and 0 the others.
+func UploaderScorer(usernames ...string) Scorer {
+	return ScorerFunc(func(torrent *Torrent) float64 {
+		for _, username := range usernames {
+			if strings.EqualFold(username, torrent.Username) {
+				return 1
+			}
+		}
+		return 0
+	})
+}
+
+// Selection represents the choice made by DownloadTorrentByTermsRanked.
+type Selection struct {
+	// Ranker is the name of the ranker used.
+	Ranker string
+	// Candidates are the torrents left by the filters, best first.
+	Candidates []Candidate
+	// Path is the location of the downloaded torrent file.
+	Path string
+}
+
+// DownloadTorrentByTermsRanked does the same as DownloadTorrentByTerms,
+// downloading the best candidate according to the ranker set with WithRanker,
+// and returns the scores of all the candidates along with the downloaded file.
+// See PlanDownload to know why torrents were left out.
+func (t *T411) DownloadTorrentByTermsRanked(title string, season, episode int, language, quality, date string) (*Selection, error) {
+	return t.DownloadTorrentByTermsRankedContext(context.Background(), title, season, episode, language, quality, date)
+}
+
+// DownloadTorrentByTermsRankedContext does the same as DownloadTorrentByTermsRanked
+// using the provided context for the underlying http requests.
+func (t *T411) DownloadTorrentByTermsRankedContext(ctx context.Context, title string, season, episode int, language, quality, date string) (*Selection, error) {
+	plan, err := t.PlanDownloadContext(ctx, title, season, episode, language, quality, date)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Pick == nil {
+		return nil, ErrTorrentNotFound
+	}
+	path, err := t.DownloadTorrentContext(ctx, plan.Pick)
+	if err != nil {
+		return nil, err
+	}
+	return &Selection{
+		Ranker:     plan.Ranker,
+		Candidates: plan.Candidates,
+		Path:       path,
+	}, nil
+}
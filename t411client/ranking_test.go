@@ -0,0 +1,127 @@
+package t411client
+
+import (
+	"context"
+	"os"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestScorers(c *C) {
+	torrent := &Torrent{
+		Name:     "Vikings.S01E01.VOSTFR.720p.HDTV.x264-GRP",
+		Username: "Niko0306",
+		Values: TorrentValues{
+			Seeders:    30,
+			Leechers:   10,
+			Size:       1000,
+			IsVerified: true,
+			Added:      time.Now().Add(-24 * time.Hour),
+		},
+	}
+	empty := &Torrent{}
+	for i, test := range []struct {
+		scorer   Scorer
+		expected [2]float64
+	}{
+		{SeedersScorer(), [2]float64{0.75, 0}},
+		{LeechersRatioScorer(), [2]float64{0.75, 0}},
+		{SizeScorer(500, 1000), [2]float64{1, 0}},
+		{SizeScorer(1001, 0), [2]float64{0, 0}},
+		{SizeScorer(0, 0), [2]float64{1, 1}},
+		{QualityScorer("1080p", "720p", "HDTV"), [2]float64{2. / 3, 0}},
+		{QualityScorer("hdtv"), [2]float64{1, 0}},
+		{LanguageScorer("MULTI", "FRENCH"), [2]float64{0, 0}},
+		{LanguageScorer("VF", "vostfr", "MULTI"), [2]float64{2. / 3, 0}},
+		{VerifiedScorer(), [2]float64{1, 0}},
+		{UploaderScorer("other", "niko0306"), [2]float64{1, 0}},
+	} {
+		c.Assert(test.scorer.Score(torrent), Equals, test.expected[0], Commentf("scorer %d", i))
+		c.Assert(test.scorer.Score(empty), Equals, test.expected[1], Commentf("scorer %d", i))
+	}
+	score := RecencyScorer(24 * time.Hour).Score(torrent)
+	c.Assert(score > 0.49 && score <= 0.5, Equals, true, Commentf("score %f", score))
+	c.Assert(RecencyScorer(time.Hour).Score(empty), Equals, float64(0))
+	score = RecencyScorer(24 * time.Hour).Score(&Torrent{Added: time.Now().UTC().Add(-24 * time.Hour).Format("2006-01-02 15:04:05")})
+	c.Assert(score > 0.4 && score <= 0.51, Equals, true, Commentf("score %f", score))
+}
+
+func (s *MySuite) TestWeightedRanker(c *C) {
+	torrents := []Torrent{
+		{ID: "1", Name: "Show.S01E01.FRENCH.720p", Values: TorrentValues{Seeders: 50}},
+		{ID: "2", Name: "Show.S01E01.VOSTFR.1080p", Values: TorrentValues{Seeders: 10}},
+		{ID: "3", Name: "Show.S01E01.VOSTFR.720p", Values: TorrentValues{Seeders: 10}},
+		{ID: "4", Name: "Show.S01E01.VOSTFR.720p", Values: TorrentValues{Seeders: 20}},
+	}
+	ids := func(candidates []Candidate) []string {
+		list := []string{}
+		for _, candidate := range candidates {
+			list = append(list, candidate.Torrent.ID)
+		}
+		return list
+	}
+	c.Assert(DefaultRanker.Name(), Equals, "seeders")
+	c.Assert(ids(DefaultRanker.Rank(torrents)), DeepEquals, []string{"1", "4", "2", "3"})
+
+	ranker := NewWeightedRanker("vostfr",
+		WeightedScorer{Name: "language", Weight: 2, Scorer: LanguageScorer("VOSTFR")},
+		WeightedScorer{Name: "quality", Weight: 1, Scorer: QualityScorer("1080p", "720p")},
+	)
+	candidates := ranker.Rank(torrents)
+	c.Assert(ids(candidates), DeepEquals, []string{"2", "4", "3", "1"})
+	c.Assert(candidates[0].Score, Equals, float64(3))
+	c.Assert(candidates[0].Scores, DeepEquals, map[string]float64{"language": 1, "quality": 1})
+	c.Assert(candidates[3].Scores, DeepEquals, map[string]float64{"language": 0, "quality": 0.5})
+	c.Assert(ranker.Rank(nil), HasLen, 0)
+
+	// torrents built by hand are ranked by their raw fields
+	handmade := []Torrent{
+		{ID: "1", Seeders: "1"},
+		{ID: "2", Seeders: "50", Leechers: "50", Size: "1000", IsVerified: "1"},
+		{ID: "3", Seeders: "3"},
+	}
+	c.Assert(ids(DefaultRanker.Rank(handmade)), DeepEquals, []string{"2", "3", "1"})
+	c.Assert(LeechersRatioScorer().Score(&handmade[1]), Equals, 0.5)
+	c.Assert(SizeScorer(1000, 0).Score(&handmade[1]), Equals, float64(1))
+	c.Assert(VerifiedScorer().Score(&handmade[1]), Equals, float64(1))
+	// equal scores are ordered by seeders, invalid ones last
+	ranker = NewWeightedRanker("none")
+	handmade = append(handmade, Torrent{ID: "4", Seeders: "many"})
+	c.Assert(ids(ranker.Rank(handmade)), DeepEquals, []string{"2", "3", "1", "4"})
+}
+
+func (s *MySuite) TestDownloadTorrentByTermsRanked(c *C) {
+	t411, _, _ := s.createT411Client(c)
+	selection, err := t411.DownloadTorrentByTermsRanked("vikings", 1, 1, "", "", "")
+	c.Assert(err, IsNil)
+	c.Assert(os.Remove(selection.Path), IsNil)
+	c.Assert(selection.Ranker, Equals, "seeders")
+	c.Assert(selection.Candidates, HasLen, 10)
+	c.Assert(selection.Candidates[0].Torrent.ID, Equals, "4831501")
+	c.Assert(selection.Candidates[0].Scores["seeders"], Equals, 57./67)
+
+	t411, err = New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithRanker(NewWeightedRanker("vostfr",
+			WeightedScorer{Name: "language", Weight: 10, Scorer: LanguageScorer("VOSTFR")},
+			WeightedScorer{Name: "seeders", Weight: 1, Scorer: SeedersScorer()},
+		)),
+	)
+	c.Assert(err, IsNil)
+	path, err := t411.DownloadTorrentByTerms("vikings", 1, 1, "", "", "")
+	c.Assert(err, IsNil)
+	c.Assert(os.Remove(path), IsNil)
+	selection, err = t411.DownloadTorrentByTermsRankedContext(context.Background(), "vikings", 1, 1, "", "", "")
+	c.Assert(err, IsNil)
+	c.Assert(os.Remove(selection.Path), IsNil)
+	c.Assert(selection.Path, Equals, path)
+	c.Assert(selection.Ranker, Equals, "vostfr")
+	c.Assert(selection.Candidates[0].Torrent.ID, Equals, "4831500")
+	c.Assert(selection.Candidates[1].Torrent.ID, Equals, "4831509")
+	c.Assert(selection.Candidates[9].Torrent.ID, Equals, "4831501")
+
+	_, err = t411.DownloadTorrentByTermsRankedContext(context.Background(), "vikings", 100, 100, "", "", "")
+	c.Assert(err, ErrorIs, ErrTorrentNotFound)
+}
@@ -0,0 +1,183 @@
+package t411client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrThrottled is returned when the API asks to retry a request
+// later than the maximum delay set with WithMaxRetryAfter.
+var ErrThrottled = errors.New("throttled by the t411 API")
+
+// RateLimit represents a token bucket rate limit: requests are allowed
+// at 'Rate' per second on average with bursts of up to 'Burst' requests.
+// A zero Rate means no limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// bucket is a token bucket for a single rate limit.
+type bucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(limit RateLimit, now time.Time) *bucket {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &bucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   now,
+	}
+}
+
+// reserve takes a token from the bucket and returns
+// how long to wait before it is actually available.
+func (b *bucket) reserve(now time.Time) time.Duration {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+		if b.tokens > float64(b.limit.Burst) {
+			b.tokens = float64(b.limit.Burst)
+		}
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.limit.Rate * float64(time.Second))
+}
+
+// rateLimiter delays requests according to a global and per-endpoint
+// token buckets and to the Retry-After delays returned by the API.
+// It is safe for concurrent use.
+type rateLimiter struct {
+	mu        sync.Mutex
+	global    *bucket
+	endpoints map[string]*bucket
+	paused    map[string]time.Time
+}
+
+func newRateLimiter(global RateLimit, endpoints map[string]RateLimit) *rateLimiter {
+	now := time.Now()
+	l := &rateLimiter{
+		global:    newBucket(global, now),
+		endpoints: map[string]*bucket{},
+		paused:    map[string]time.Time{},
+	}
+	for endpoint, limit := range endpoints {
+		if b := newBucket(limit, now); b != nil {
+			l.endpoints[endpoint] = b
+		}
+	}
+	return l
+}
+
+// reserve returns how long to wait before doing a request to 'endpoint'.
+func (l *rateLimiter) reserve(endpoint string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	delay := l.paused[endpoint].Sub(now)
+	for _, b := range []*bucket{l.global, l.endpoints[endpoint]} {
+		if b == nil {
+			continue
+		}
+		if d := b.reserve(now); d > delay {
+			delay = d
+		}
+	}
+	return delay
+}
+
+// wait blocks until a request to 'endpoint' is allowed or the context is done.
+func (l *rateLimiter) wait(ctx context.Context, endpoint string) error {
+	delay := l.reserve(endpoint)
+	if delay <= 0 {
+		return nil
+	}
+	return sleepContext(ctx, delay)
+}
+
+// pause delays the requests to 'endpoint' for 'delay'.
+func (l *rateLimiter) pause(endpoint string, delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until := time.Now().Add(delay)
+	if until.After(l.paused[endpoint]) {
+		l.paused[endpoint] = until
+	}
+}
+
+// endpoint returns the API endpoint requested by 'u', one
+// of the Endpoint constants or the path of 'u' if unknown.
+func (t *T411) endpoint(u *url.URL) string {
+	path := u.Path
+	baseURL := t.getBaseURL()
+	if i := t.mirrorOf(u); i >= 0 {
+		baseURL = t.mirrors[i]
+	}
+	if base, err := url.Parse(baseURL); err == nil {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(base.Path, "/"))
+	}
+	for _, endpoint := range endpoints {
+		if path == endpoint || strings.HasPrefix(path, endpoint+"/") {
+			return endpoint
+		}
+	}
+	return path
+}
+
+// parseRetryAfter parses a Retry-After header value,
+// either a number of seconds or an http date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			seconds = 0
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	delay := date.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	return delay, true
+}
+
+// rewindRequest returns a copy of 'req' with a fresh body so that it can be sent again.
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return clone, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("cannot send the request body again")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	clone.Body = body
+	return clone, nil
+}
@@ -0,0 +1,108 @@
+package t411client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/dns-gh/t411-client/t411client/t411test"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestRateLimit(c *C) {
+	t411, err := New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithEndpointRateLimit(SearchEndpoint, RateLimit{Rate: 20, Burst: 2}),
+	)
+	c.Assert(err, IsNil)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		checkUser(c, t411, testUsername)
+	}
+	c.Assert(time.Since(start) < 100*time.Millisecond, Equals, true)
+	start = time.Now()
+	for i := 0; i < 6; i++ {
+		_, err = t411.Search(NewSearchQuery("vikings"))
+		c.Assert(err, IsNil)
+	}
+	c.Assert(time.Since(start) >= 190*time.Millisecond, Equals, true)
+
+	t411, err = New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithRateLimit(RateLimit{Rate: 50}),
+	)
+	c.Assert(err, IsNil)
+	start = time.Now()
+	for i := 0; i < 5; i++ {
+		checkUser(c, t411, testUsername)
+	}
+	c.Assert(time.Since(start) >= 90*time.Millisecond, Equals, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	t411.limiter.pause(UsersProfileEndpoint, time.Minute)
+	_, err = t411.UsersProfileContext(ctx, "12345")
+	c.Assert(err, Equals, context.DeadlineExceeded)
+}
+
+func (s *MySuite) TestRetryAfter(c *C) {
+	// the POST authentication request is sent again
+	s.server.InjectThrottle(t411test.AuthAPI, http.StatusServiceUnavailable, "0")
+	t411, err := New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithMaxRetryAfter(time.Second),
+		WithRetryPolicy(fastRetryPolicy),
+	)
+	c.Assert(err, IsNil)
+	c.Assert(s.server.Hits(t411test.AuthAPI), Equals, 2)
+
+	s.server.InjectThrottle(t411test.TorrentsSearchAPI, http.StatusTooManyRequests, "0")
+	_, err = t411.Search(NewSearchQuery("vikings"))
+	c.Assert(err, IsNil)
+	c.Assert(s.server.Hits(t411test.TorrentsSearchAPI), Equals, 2)
+
+	// requests are sent again only once
+	s.server.InjectThrottle(t411test.TorrentsSearchAPI, http.StatusTooManyRequests, "0")
+	s.server.InjectThrottle(t411test.TorrentsSearchAPI, http.StatusTooManyRequests, "0")
+	_, err = t411.Search(NewSearchQuery("vikings"))
+	c.Assert(err, ErrorIs, ErrThrottled)
+	c.Assert(s.server.Hits(t411test.TorrentsSearchAPI), Equals, 4)
+
+	// delays longer than the maximum one pause the endpoint
+	s.server.InjectThrottle(t411test.TorrentsSearchAPI, http.StatusTooManyRequests, "60")
+	_, err = t411.Search(NewSearchQuery("vikings"))
+	c.Assert(err, ErrorMatches, "throttled by the t411 API: '/torrents/search' API asked to retry after 1m0s")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = t411.SearchContext(ctx, NewSearchQuery("vikings"))
+	c.Assert(err, ErrorMatches, ".*context deadline exceeded")
+	c.Assert(s.server.Hits(t411test.TorrentsSearchAPI), Equals, 5)
+	checkUser(c, t411, testUsername)
+
+	// responses without Retry-After header are left to the retry policy
+	s.server.InjectThrottle(t411test.UsersProfileAPI, http.StatusServiceUnavailable, "")
+	checkUser(c, t411, testUsername)
+	c.Assert(s.server.Hits(t411test.UsersProfileAPI), Equals, 3)
+}
+
+func (s *MySuite) TestParseRetryAfter(c *C) {
+	now := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+	for value, expected := range map[string]time.Duration{
+		"120":                           2 * time.Minute,
+		" 0 ":                           0,
+		"-5":                            0,
+		"Wed, 21 Oct 2015 07:28:30 GMT": 30 * time.Second,
+		"Wed, 21 Oct 2015 07:27:00 GMT": 0,
+	} {
+		delay, ok := parseRetryAfter(value, now)
+		c.Assert(ok, Equals, true, Commentf("value %q", value))
+		c.Assert(delay, Equals, expected, Commentf("value %q", value))
+	}
+	for _, value := range []string{"", "soon", "1.5"} {
+		_, ok := parseRetryAfter(value, now)
+		c.Assert(ok, Equals, false, Commentf("value %q", value))
+	}
+}
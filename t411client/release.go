@@ -0,0 +1,332 @@
+package t411client
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxRangeLength is the maximum number of seasons or episodes of a range,
+// longer ranges are most likely not ranges.
+const maxRangeLength = 100
+
+// Release represents the metadata parsed from a release name
+// such as 'Vikings.S01E01.FRENCH.720p.HDTV.x264-ATeam'.
+// Fields not found in the name are left empty.
+type Release struct {
+	// Title is the name of the movie or the show, words separated by spaces.
+	Title string
+	Year  int
+	// Seasons and Episodes hold several values for ranges like
+	// 'S01-S03' or 'S01E01-E03' and multi-episodes like 'S01E01E02'.
+	Seasons  []int
+	Episodes []int
+	// Complete is set for complete series or seasons, 'Integrale' for instance.
+	Complete bool
+	// Resolution is the vertical resolution like '720p' or '2160p'.
+	Resolution string
+	// Source is the origin of the video like 'HDTV', 'WEB-DL' or 'BluRay'.
+	Source string
+	// Codec is the video codec like 'x264' or 'HEVC'.
+	Codec string
+	// Audio is the audio codec like 'AC3' or 'DTS'.
+	Audio string
+	// Languages are the language tags like 'VOSTFR', 'MULTI' or 'TRUEFRENCH'.
+	Languages []string
+	// Group is the release group.
+	Group  string
+	Proper bool
+	Repack bool
+}
+
+var (
+	releaseSeparators = regexp.MustCompile(`[\s._\[\]()]+`)
+	releaseGroup      = regexp.MustCompile(`-([A-Za-z0-9]*[A-Za-z][A-Za-z0-9]*)$`)
+	bracketGroup      = regexp.MustCompile(`^\[([^\[\]]+)\]|\[([^\[\]]+)\]$`)
+	seasonEpisodes    = regexp.MustCompile(`^s(\d{1,2})((?:e\d{1,3})+)$`)
+	episodeRange      = regexp.MustCompile(`^s(\d{1,2})e(\d{1,3})-e?(\d{1,3})$`)
+	seasonRange       = regexp.MustCompile(`^s(\d{1,2})(?:-s?(\d{1,2}))?$`)
+	crossEpisode      = regexp.MustCompile(`^(\d{1,2})x(\d{2,3})$`)
+	numberRange       = regexp.MustCompile(`^(\d{1,3})(?:-(\d{1,3}))?$`)
+	episodeNumber     = regexp.MustCompile(`^e(\d{1,3})$`)
+	resolution        = regexp.MustCompile(`^(\d{3,4})[pi]$`)
+	year              = regexp.MustCompile(`^(19|20)\d\d$`)
+
+	releaseExtensions = map[string]bool{
+		".avi":     true,
+		".m4v":     true,
+		".mkv":     true,
+		".mp4":     true,
+		".torrent": true,
+	}
+	releaseSources = map[string]string{
+		"bdrip":   "BDRip",
+		"bluray":  "BluRay",
+		"blu-ray": "BluRay",
+		"brrip":   "BRRip",
+		"dvd":     "DVD",
+		"dvdrip":  "DVDRip",
+		"dvdscr":  "DVDScr",
+		"hdlight": "HDLight",
+		"hdrip":   "HDRip",
+		"hdtv":    "HDTV",
+		"pdtv":    "PDTV",
+		"tvrip":   "TVRip",
+		"web":     "WEB",
+		"web-dl":  "WEB-DL",
+		"webdl":   "WEB-DL",
+		"webrip":  "WEBRip",
+	}
+	releaseCodecs = map[string]string{
+		"av1":  "AV1",
+		"avc":  "AVC",
+		"divx": "DivX",
+		"h264": "H264",
+		"h265": "H265",
+		"hevc": "HEVC",
+		"x264": "x264",
+		"x265": "x265",
+		"xvid": "XviD",
+	}
+	releaseAudios = map[string]string{
+		"aac":    "AAC",
+		"ac3":    "AC3",
+		"dd":     "DD",
+		"dd5":    "DD",
+		"ddp":    "DDP",
+		"ddp5":   "DDP",
+		"dts":    "DTS",
+		"dts-hd": "DTS-HD",
+		"eac3":   "EAC3",
+		"flac":   "FLAC",
+		"mp3":    "MP3",
+		"truehd": "TrueHD",
+	}
+	releaseLanguages = map[string]string{
+		"english":    "ENGLISH",
+		"french":     "FRENCH",
+		"multi":      "MULTI",
+		"subfrench":  "SUBFRENCH",
+		"truefrench": "TRUEFRENCH",
+		"vf":         "VF",
+		"vff":        "VFF",
+		"vfq":        "VFQ",
+		"vo":         "VO",
+		"vost":       "VOST",
+		"vostfr":     "VOSTFR",
+	}
+	// rangeWords separate the bounds of ranges like 'Saison 1 a 8'
+	rangeWords = map[string]bool{
+		"a":  true,
+		"à":  true,
+		"au": true,
+		"to": true,
+	}
+	releaseComplete = map[string]bool{
+		"complete":  true,
+		"complet":   true,
+		"complète":  true,
+		"integral":  true,
+		"integrale": true,
+		"intégrale": true,
+	}
+)
+
+// ParseRelease extracts the metadata of the release name 'name'.
+// The title ends at the first token that is not part of it: a year,
+// a season or an episode, a resolution, a language tag and so on.
+func ParseRelease(name string) *Release {
+	release := &Release{}
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndex(name, "."); i >= 0 && releaseExtensions[strings.ToLower(name[i:])] {
+		name = name[:i]
+	}
+	name = release.parseGroup(name)
+	tokens := []string{}
+	for _, token := range releaseSeparators.Split(name, -1) {
+		token = strings.Trim(token, "-")
+		if len(token) != 0 {
+			tokens = append(tokens, token)
+		}
+	}
+	end := len(tokens)
+	for i := 0; i < len(tokens); i++ {
+		n := release.parseToken(tokens, i)
+		if n == 0 {
+			continue
+		}
+		if i < end {
+			end = i
+		}
+		i += n - 1
+	}
+	// the last year before the other tags, if not the first word,
+	// so that '2012.2009' is the movie 2012 released in 2009
+	for i := end - 1; i > 0; i-- {
+		if year.MatchString(tokens[i]) {
+			release.Year = atoi(tokens[i])
+			end = i
+			break
+		}
+	}
+	for i := end; i < len(tokens) && release.Year == 0; i++ {
+		if i > 0 && year.MatchString(tokens[i]) {
+			release.Year = atoi(tokens[i])
+		}
+	}
+	release.Title = strings.Join(tokens[:end], " ")
+	return release
+}
+
+// parseGroup extracts the release group from 'name', either a '-GROUP' suffix
+// or a leading or trailing '[GROUP]', and returns the rest of the name.
+func (r *Release) parseGroup(name string) string {
+	if m := bracketGroup.FindStringSubmatch(name); m != nil {
+		group := strings.TrimSpace(m[1] + m[2])
+		if !isReleaseTag(group) {
+			r.Group = group
+			return strings.Replace(name, m[0], " ", 1)
+		}
+	}
+	if m := releaseGroup.FindStringSubmatchIndex(name); m != nil {
+		start := strings.LastIndexAny(name[:m[0]], " ._[]()") + 1
+		// tags like 'WEB-DL' or 'DTS-HD' are not groups
+		if !isReleaseTag(name[start:]) && !isReleaseTag(name[m[2]:m[3]]) {
+			r.Group = name[m[2]:m[3]]
+			return name[:m[0]]
+		}
+	}
+	return name
+}
+
+func isReleaseTag(token string) bool {
+	probe := &Release{}
+	return probe.parseToken([]string{token}, 0) != 0
+}
+
+// parseToken fills the release with the tag starting at tokens[i] and
+// returns the number of tokens it spans, 0 if tokens[i] is not a tag.
+func (r *Release) parseToken(tokens []string, i int) int {
+	token := strings.ToLower(tokens[i])
+	next := ""
+	if i+1 < len(tokens) {
+		next = strings.ToLower(tokens[i+1])
+	}
+	switch {
+	case seasonEpisodes.MatchString(token):
+		m := seasonEpisodes.FindStringSubmatch(token)
+		r.Seasons = []int{atoi(m[1])}
+		for _, episode := range strings.Split(m[2], "e")[1:] {
+			r.Episodes = append(r.Episodes, atoi(episode))
+		}
+	case episodeRange.MatchString(token):
+		m := episodeRange.FindStringSubmatch(token)
+		r.Seasons = []int{atoi(m[1])}
+		r.Episodes = numbers(atoi(m[2]), atoi(m[3]))
+	case seasonRange.MatchString(token):
+		m := seasonRange.FindStringSubmatch(token)
+		r.Seasons = numbers(atoi(m[1]), atoiOr(m[2], m[1]))
+	case crossEpisode.MatchString(token):
+		m := crossEpisode.FindStringSubmatch(token)
+		r.Seasons = []int{atoi(m[1])}
+		r.Episodes = []int{atoi(m[2])}
+	case token == "saison" || token == "season":
+		seasons, n := parseNumbers(tokens, i+1)
+		if n == 0 {
+			return 0
+		}
+		r.Seasons = seasons
+		return n + 1
+	case token == "episode" || token == "ep":
+		episodes, n := parseNumbers(tokens, i+1)
+		if n == 0 {
+			return 0
+		}
+		r.Episodes = episodes
+		return n + 1
+	case episodeNumber.MatchString(token) && len(r.Seasons) != 0:
+		r.Episodes = []int{atoi(episodeNumber.FindStringSubmatch(token)[1])}
+	case releaseComplete[token]:
+		r.Complete = true
+	case resolution.MatchString(token):
+		r.Resolution = resolution.FindStringSubmatch(token)[1] + "p"
+	case token == "4k" || token == "uhd":
+		r.Resolution = "2160p"
+	case token == "web" && next == "dl":
+		r.Source = "WEB-DL"
+		return 2
+	case releaseSources[token] != "":
+		r.Source = releaseSources[token]
+	case token == "h" && (next == "264" || next == "265"):
+		r.Codec = "H" + next
+		return 2
+	case releaseCodecs[token] != "":
+		r.Codec = releaseCodecs[token]
+	case releaseAudios[token] != "":
+		if len(r.Audio) == 0 {
+			r.Audio = releaseAudios[token]
+		}
+		// channels such as 'DD5.1' are split by the separators
+		if strings.HasSuffix(token, "5") && next == "1" {
+			return 2
+		}
+	case releaseLanguages[token] != "":
+		r.Languages = append(r.Languages, releaseLanguages[token])
+	case token == "proper":
+		r.Proper = true
+	case token == "repack":
+		r.Repack = true
+	default:
+		return 0
+	}
+	return 1
+}
+
+// parseNumbers parses the number or the range of numbers starting at tokens[i],
+// like '1', '1-8' or '1 a 8', and returns the number of tokens it spans,
+// 0 if tokens[i] is not a number.
+func parseNumbers(tokens []string, i int) ([]int, int) {
+	if i >= len(tokens) {
+		return nil, 0
+	}
+	m := numberRange.FindStringSubmatch(tokens[i])
+	if m == nil {
+		return nil, 0
+	}
+	if len(m[2]) == 0 && i+2 < len(tokens) && rangeWords[strings.ToLower(tokens[i+1])] {
+		if last := numberRange.FindStringSubmatch(tokens[i+2]); last != nil && len(last[2]) == 0 {
+			return numbers(atoi(m[1]), atoi(last[1])), 3
+		}
+	}
+	return numbers(atoi(m[1]), atoiOr(m[2], m[1])), 1
+}
+
+func atoi(value string) int {
+	n, _ := strconv.Atoi(value)
+	return n
+}
+
+func atoiOr(value, fallback string) int {
+	if len(value) == 0 {
+		return atoi(fallback)
+	}
+	return atoi(value)
+}
+
+// numbers returns the numbers from 'first' to 'last',
+// only 'first' if the range is invalid.
+func numbers(first, last int) []int {
+	if last < first || last-first >= maxRangeLength {
+		return []int{first}
+	}
+	values := make([]int, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		values = append(values, i)
+	}
+	return values
+}
+
+// Release parses the name of the torrent, see ParseRelease.
+func (t *Torrent) Release() *Release {
+	return ParseRelease(t.Name)
+}
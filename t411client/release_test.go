@@ -0,0 +1,137 @@
+package t411client
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestParseRelease(c *C) {
+	for name, expected := range map[string]*Release{
+		"Vikings.S01E01.FRENCH.720p.HDTV.x264-ATeam": {
+			Title:      "Vikings",
+			Seasons:    []int{1},
+			Episodes:   []int{1},
+			Resolution: "720p",
+			Source:     "HDTV",
+			Codec:      "x264",
+			Languages:  []string{"FRENCH"},
+			Group:      "ATeam",
+		},
+		"Vikings Saison 1 VOSTFR": {
+			Title:     "Vikings",
+			Seasons:   []int{1},
+			Languages: []string{"VOSTFR"},
+		},
+		"Stargate SG-1 Saison 1 a 8 FRENCH DVDRip": {
+			Title:     "Stargate SG-1",
+			Seasons:   []int{1, 2, 3, 4, 5, 6, 7, 8},
+			Source:    "DVDRip",
+			Languages: []string{"FRENCH"},
+		},
+		"Stargate SG-1 - Saison 1 à 8 [Intégrale] FRENCH": {
+			Title:     "Stargate SG-1",
+			Seasons:   []int{1, 2, 3, 4, 5, 6, 7, 8},
+			Complete:  true,
+			Languages: []string{"FRENCH"},
+		},
+		"Vikings Saison 2 A Venir": {
+			Title:   "Vikings",
+			Seasons: []int{2},
+		},
+		"Vikings.S01E01.HDTV.x264.2HD.VOSTFR": {
+			Title:     "Vikings",
+			Seasons:   []int{1},
+			Episodes:  []int{1},
+			Source:    "HDTV",
+			Codec:     "x264",
+			Languages: []string{"VOSTFR"},
+		},
+		"Game.of.Thrones.S02E01E02.MULTI.1080p.BluRay.DTS-HD.x265.PROPER-GRP.mkv": {
+			Title:      "Game of Thrones",
+			Seasons:    []int{2},
+			Episodes:   []int{1, 2},
+			Resolution: "1080p",
+			Source:     "BluRay",
+			Codec:      "x265",
+			Audio:      "DTS-HD",
+			Languages:  []string{"MULTI"},
+			Group:      "GRP",
+			Proper:     true,
+		},
+		"Show.S03E04-E06.REPACK.WEB-DL": {
+			Title:    "Show",
+			Seasons:  []int{3},
+			Episodes: []int{4, 5, 6},
+			Source:   "WEB-DL",
+			Repack:   true,
+		},
+		"Show S01-S03 Complete TRUEFRENCH WEB.DL H.264 DD5.1": {
+			Title:     "Show",
+			Seasons:   []int{1, 2, 3},
+			Complete:  true,
+			Source:    "WEB-DL",
+			Codec:     "H264",
+			Audio:     "DD",
+			Languages: []string{"TRUEFRENCH"},
+		},
+		"Stargate.SG-1.Integrale.FRENCH.DVDRip": {
+			Title:     "Stargate SG-1",
+			Complete:  true,
+			Source:    "DVDRip",
+			Languages: []string{"FRENCH"},
+		},
+		"Stargate.SG-1.S01.FRENCH.DVDRip.XviD": {
+			Title:     "Stargate SG-1",
+			Seasons:   []int{1},
+			Source:    "DVDRip",
+			Codec:     "XviD",
+			Languages: []string{"FRENCH"},
+		},
+		"Avatar.2009.FRENCH.DVDRip": {
+			Title:     "Avatar",
+			Year:      2009,
+			Source:    "DVDRip",
+			Languages: []string{"FRENCH"},
+		},
+		"2012.2009.MULTI.2160p.UHD": {
+			Title:      "2012",
+			Year:       2009,
+			Resolution: "2160p",
+			Languages:  []string{"MULTI"},
+		},
+		"[GRP] The Show 1x05 (2014) VOSTFR AAC": {
+			Title:     "The Show",
+			Year:      2014,
+			Seasons:   []int{1},
+			Episodes:  []int{5},
+			Audio:     "AAC",
+			Languages: []string{"VOSTFR"},
+			Group:     "GRP",
+		},
+		"Show_Season_2_Episode_3-10_VOST_FR_[720p]": {
+			Title:      "Show",
+			Seasons:    []int{2},
+			Episodes:   []int{3, 4, 5, 6, 7, 8, 9, 10},
+			Resolution: "720p",
+			Languages:  []string{"VOST"},
+		},
+		"Show.S01E01.1080i.HDTV.2015": {
+			Title:      "Show",
+			Year:       2015,
+			Seasons:    []int{1},
+			Episodes:   []int{1},
+			Resolution: "1080p",
+			Source:     "HDTV",
+		},
+		"Show.S01E05-01.HDTV": {
+			Title:    "Show",
+			Seasons:  []int{1},
+			Episodes: []int{5},
+			Source:   "HDTV",
+		},
+		"": {},
+	} {
+		c.Assert(ParseRelease(name), DeepEquals, expected, Commentf("name %q", name))
+	}
+	torrent := &Torrent{Name: "Vikings.S02E03.VOSTFR"}
+	c.Assert(torrent.Release().Episodes, DeepEquals, []int{3})
+}
@@ -0,0 +1,100 @@
+package t411client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy represents how GET requests failing transiently are retried.
+// Authentication requests are never retried so that wrong credentials,
+// disabled accounts or unknown users are reported immediately.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, retries being disabled if lower than 2.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled at each attempt.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts, if positive.
+	MaxDelay time.Duration
+	// Retryable reports whether a failed attempt should be retried, given its
+	// response or the error returned while sending it or reading its body.
+	// DefaultRetryable is used if nil.
+	Retryable func(resp *http.Response, err error) bool
+}
+
+// DefaultRetryPolicy is the retry policy used by default.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// DefaultRetryable retries network errors, truncated bodies and 5xx
+// status codes but the 501 one. Throttled requests are not retried
+// since the Retry-After delay has already been honored, nor TLS handshake
+// and certificate errors since they fail the same way every time.
+func DefaultRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrThrottled) && !isTLSFailure(err)
+	}
+	return resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented
+}
+
+func (p RetryPolicy) retryable(resp *http.Response, err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(resp, err)
+	}
+	return DefaultRetryable(resp, err)
+}
+
+// backoff returns the delay before the attempt following 'attempt',
+// picked randomly between the half and the whole of the exponential delay.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// bufferBody reads the whole response body so that
+// errors reading it happen before it is returned.
+func bufferBody(resp *http.Response) error {
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return err
+}
+
+func describeFailure(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("http status %s", resp.Status)
+}
+
+// sleepContext waits for 'delay' or until the context is done.
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
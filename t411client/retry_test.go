@@ -0,0 +1,200 @@
+package t411client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing/iotest"
+	"time"
+
+	"github.com/dns-gh/t411-client/t411client/t411test"
+	. "gopkg.in/check.v1"
+)
+
+var fastRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    2 * time.Millisecond,
+}
+
+// flakyTransport fails the first requests to the search endpoint,
+// either with a network error or with a truncated body.
+type flakyTransport struct {
+	mu        sync.Mutex
+	failures  int
+	truncated bool
+}
+
+type truncatedBody struct {
+	io.Reader
+}
+
+func (truncatedBody) Close() error { return nil }
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	fail := f.failures > 0 && strings.Contains(req.URL.Path, SearchEndpoint)
+	if fail {
+		f.failures--
+	}
+	f.mu.Unlock()
+	if !fail {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	if !f.truncated {
+		return nil, errors.New("connection reset by peer")
+	}
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = truncatedBody{io.MultiReader(strings.NewReader(string(data[:len(data)/2])), iotest.ErrReader(io.ErrUnexpectedEOF))}
+	return resp, nil
+}
+
+func (s *MySuite) createRetryingClient(c *C, opts ...Option) *T411 {
+	t411, err := New(append([]Option{
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithRetryPolicy(fastRetryPolicy),
+	}, opts...)...)
+	c.Assert(err, IsNil)
+	return t411
+}
+
+func (s *MySuite) TestRetry(c *C) {
+	t411 := s.createRetryingClient(c)
+	s.server.InjectThrottle(t411test.TorrentsSearchAPI, http.StatusBadGateway, "")
+	s.server.InjectThrottle(t411test.TorrentsSearchAPI, http.StatusInternalServerError, "")
+	torrents, err := t411.Search(NewSearchQuery("vikings"))
+	c.Assert(err, IsNil)
+	c.Assert(torrents.Torrents, HasLen, 10)
+	c.Assert(s.server.Hits(t411test.TorrentsSearchAPI), Equals, 3)
+
+	// the last attempt is returned
+	for i := 0; i < 3; i++ {
+		s.server.InjectThrottle(t411test.TorrentsSearchAPI, http.StatusInternalServerError, "")
+	}
+	_, err = t411.Search(NewSearchQuery("vikings"))
+	c.Assert(err, NotNil)
+	c.Assert(s.server.Hits(t411test.TorrentsSearchAPI), Equals, 6)
+
+	// client errors are not retried
+	s.server.InjectThrottle(t411test.TorrentsSearchAPI, http.StatusBadRequest, "")
+	_, err = t411.Search(NewSearchQuery("vikings"))
+	c.Assert(err, NotNil)
+	c.Assert(s.server.Hits(t411test.TorrentsSearchAPI), Equals, 7)
+
+	// network errors and truncated bodies are retried
+	transport := &flakyTransport{failures: 2}
+	t411 = s.createRetryingClient(c, WithTransport(transport))
+	_, err = t411.Search(NewSearchQuery("vikings"))
+	c.Assert(err, IsNil)
+	transport.failures, transport.truncated = 2, true
+	torrents, err = t411.Search(NewSearchQuery("vikings"))
+	c.Assert(err, IsNil)
+	c.Assert(torrents.Torrents, HasLen, 10)
+	transport.failures = 3
+	_, err = t411.Search(NewSearchQuery("vikings"))
+	c.Assert(err, Equals, io.ErrUnexpectedEOF)
+	c.Assert(s.server.Hits(t411test.TorrentsSearchAPI), Equals, 14)
+
+	// custom and disabled policies
+	policy := fastRetryPolicy
+	policy.Retryable = func(resp *http.Response, err error) bool {
+		return err == nil && resp.StatusCode == http.StatusBadRequest
+	}
+	t411 = s.createRetryingClient(c, WithRetryPolicy(policy))
+	s.server.InjectThrottle(t411test.TorrentsSearchAPI, http.StatusBadRequest, "")
+	_, err = t411.Search(NewSearchQuery("vikings"))
+	c.Assert(err, IsNil)
+	c.Assert(s.server.Hits(t411test.TorrentsSearchAPI), Equals, 16)
+	t411 = s.createRetryingClient(c, WithRetryPolicy(RetryPolicy{}))
+	s.server.InjectThrottle(t411test.TorrentsSearchAPI, http.StatusInternalServerError, "")
+	_, err = t411.Search(NewSearchQuery("vikings"))
+	c.Assert(err, NotNil)
+	c.Assert(s.server.Hits(t411test.TorrentsSearchAPI), Equals, 17)
+}
+
+func (s *MySuite) TestRetryAuth(c *C) {
+	s.server.InjectThrottle(t411test.AuthAPI, http.StatusInternalServerError, "")
+	_, err := New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithRetryPolicy(fastRetryPolicy),
+	)
+	c.Assert(err, NotNil)
+	c.Assert(s.server.Hits(t411test.AuthAPI), Equals, 1)
+
+	for _, code := range []int{t411test.CodeUserNotFound, t411test.CodeAccountDisabled, t411test.CodeWrongPassword} {
+		s.server.InjectError(t411test.AuthAPI, code)
+		_, err = New(
+			WithBaseURL(s.server.URL),
+			WithCredentials(testUsername, testPassword),
+			WithRetryPolicy(fastRetryPolicy),
+		)
+		c.Assert(err, FitsTypeOf, &APIError{})
+	}
+	c.Assert(s.server.Hits(t411test.AuthAPI), Equals, 4)
+}
+
+func (s *MySuite) TestRetryBackoff(c *C) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, max := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		3:  400 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		60: time.Second,
+	} {
+		for i := 0; i < 10; i++ {
+			delay := policy.backoff(attempt)
+			c.Assert(delay >= max/2 && delay <= max, Equals, true, Commentf("attempt %d: %s", attempt, delay))
+		}
+	}
+	c.Assert(RetryPolicy{}.backoff(1), Equals, time.Duration(0))
+}
+
+func (s *MySuite) TestDefaultRetryable(c *C) {
+	wrap := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://api.t411.test/torrents/search/", Err: err}
+	}
+	for _, err := range []error{
+		wrap(errors.New("connection reset by peer")),
+		io.ErrUnexpectedEOF,
+	} {
+		c.Assert(DefaultRetryable(nil, err), Equals, true, Commentf("%v", err))
+	}
+	for _, err := range []error{
+		wrap(ErrThrottled),
+		wrap(x509.UnknownAuthorityError{}),
+		wrap(x509.HostnameError{Host: "api.t411.test"}),
+		wrap(x509.CertificateInvalidError{Reason: x509.Expired}),
+		wrap(&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}),
+		wrap(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}),
+	} {
+		c.Assert(DefaultRetryable(nil, err), Equals, false, Commentf("%v", err))
+	}
+	for code, retryable := range map[int]bool{
+		http.StatusOK:                  false,
+		http.StatusNotFound:            false,
+		http.StatusInternalServerError: true,
+		http.StatusNotImplemented:      false,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+	} {
+		c.Assert(DefaultRetryable(&http.Response{StatusCode: code}, nil), Equals, retryable, Commentf("%d", code))
+	}
+}
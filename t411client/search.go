@@ -0,0 +1,273 @@
+package t411client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidQuery is returned when searching with an invalid SearchQuery.
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// SearchQuery represents the parameters of a torrents search.
+// It is built by chaining its methods, the first error encountered
+// being returned when searching with it:
+//
+//	query := NewSearchQuery("vikings").Season(1).Episode(1).Languages("vostfr", "multi-fr").Limit(50)
+//	torrents, err := client.Search(query)
+type SearchQuery struct {
+	title      string
+	terms      map[int][]int
+	categories []int
+	mappings   *TermMappings
+	offset     int
+	limit      int
+	err        error
+}
+
+// NewSearchQuery creates a query searching torrents matching 'title'.
+// Seasons, episodes, languages and qualities are resolved with the
+// built-in term mappings, see T411.NewSearchQuery to use the resolved ones.
+func NewSearchQuery(title string) *SearchQuery {
+	return newSearchQuery(builtinTerms, title)
+}
+
+func newSearchQuery(mappings *TermMappings, title string) *SearchQuery {
+	return &SearchQuery{
+		title:    title,
+		terms:    map[int][]int{},
+		mappings: mappings,
+		offset:   -1,
+	}
+}
+
+// NewSearchQuery creates a query searching torrents matching 'title'
+// resolving seasons, episodes, languages and qualities with the term
+// mappings of the client. See WithTermResolver.
+func (t *T411) NewSearchQuery(title string) *SearchQuery {
+	return t.NewSearchQueryContext(context.Background(), title)
+}
+
+// NewSearchQueryContext does the same as NewSearchQuery using the
+// provided context for the underlying http requests.
+func (t *T411) NewSearchQueryContext(ctx context.Context, title string) *SearchQuery {
+	return newSearchQuery(t.termMappings(ctx), title)
+}
+
+// termsQuery converts the positional parameters of SearchTorrentsByTerms to a query.
+// Unknown languages, qualities, seasons and episodes are kept as
+// they were before the SearchQuery was introduced.
+func termsQuery(mappings *TermMappings, title string, season, episode int, language, quality string, offset, limit int) *SearchQuery {
+	query := newSearchQuery(mappings, title)
+	if season >= 0 {
+		query.Term(mappings.SeasonTypeID, mappings.Seasons[season])
+	}
+	if episode >= 0 {
+		query.Term(mappings.EpisodeTypeID, mappings.Episodes[episode])
+	}
+	if ID, ok := mappings.Languages[strings.ToLower(language)]; ok {
+		query.Term(mappings.LanguageTypeID, ID)
+	}
+	if ID, ok := mappings.Qualities[quality]; ok {
+		query.Term(mappings.QualityTypeID, ID)
+	}
+	return query.Offset(offset).Limit(limit)
+}
+
+func (q *SearchQuery) clone() *SearchQuery {
+	clone := *q
+	clone.terms = map[int][]int{}
+	for k, v := range q.terms {
+		clone.terms[k] = append([]int{}, v...)
+	}
+	clone.categories = append([]int{}, q.categories...)
+	return &clone
+}
+
+func (q *SearchQuery) setErr(format string, args ...interface{}) {
+	if q.err == nil {
+		q.err = fmt.Errorf("%w: %s", ErrInvalidQuery, fmt.Sprintf(format, args...))
+	}
+}
+
+// Term adds the term 'termID' of the term type 'typeID' to the query,
+// that is the 'term[typeID][]=termID' parameter.
+// Torrents must match one of the terms of every term type of the query.
+func (q *SearchQuery) Term(typeID, termID int) *SearchQuery {
+	for _, v := range q.terms[typeID] {
+		if v == termID {
+			return q
+		}
+	}
+	q.terms[typeID] = append(q.terms[typeID], termID)
+	return q
+}
+
+// Season restricts the search to a season, from 1 to 30 with the built-in
+// term mappings, 0 meaning the complete/integral tv show.
+func (q *SearchQuery) Season(season int) *SearchQuery {
+	ID, ok := q.mappings.Seasons[season]
+	if !ok {
+		q.setErr("unknown season %d", season)
+		return q
+	}
+	return q.Term(q.mappings.SeasonTypeID, ID)
+}
+
+// Episode restricts the search to an episode, from 1 to 60 with the built-in
+// term mappings, 0 meaning the complete season.
+func (q *SearchQuery) Episode(episode int) *SearchQuery {
+	ID, ok := q.mappings.Episodes[episode]
+	if !ok {
+		q.setErr("unknown episode %d", episode)
+		return q
+	}
+	return q.Term(q.mappings.EpisodeTypeID, ID)
+}
+
+// Languages restricts the search to torrents in one of the given languages.
+// They must be keys of the LanguageMap variable or, with resolved term mappings,
+// lowercased labels of the terms tree.
+func (q *SearchQuery) Languages(languages ...string) *SearchQuery {
+	for _, language := range languages {
+		ID, ok := q.mappings.Languages[strings.ToLower(language)]
+		if !ok {
+			q.setErr("unknown language %q", language)
+			continue
+		}
+		q.Term(q.mappings.LanguageTypeID, ID)
+	}
+	return q
+}
+
+// Qualities restricts the search to torrents with one of the given qualities.
+// They must be keys of the QualityMap variable or labels of the terms tree.
+func (q *SearchQuery) Qualities(qualities ...string) *SearchQuery {
+	for _, quality := range qualities {
+		ID, ok := q.mappings.Qualities[quality]
+		if !ok {
+			q.setErr("unknown quality %q", quality)
+			continue
+		}
+		q.Term(q.mappings.QualityTypeID, ID)
+	}
+	return q
+}
+
+// Categories restricts the search to torrents in one of the given category ids,
+// that is the 'cid' parameter.
+func (q *SearchQuery) Categories(categoryIDs ...int) *SearchQuery {
+	for _, ID := range categoryIDs {
+		found := false
+		for _, v := range q.categories {
+			found = found || v == ID
+		}
+		if !found {
+			q.categories = append(q.categories, ID)
+		}
+	}
+	return q
+}
+
+// CategoryNames restricts the search to torrents in one of the named
+// categories or their subcategories, resolved against the 'categories' tree.
+func (q *SearchQuery) CategoryNames(categories *Categories, names ...string) *SearchQuery {
+	IDs, err := categories.Resolve(names...)
+	if err != nil {
+		if q.err == nil {
+			q.err = fmt.Errorf("%w: %w", ErrInvalidQuery, err)
+		}
+		return q
+	}
+	return q.Categories(IDs...)
+}
+
+// Offset sets the index of the first result to return. A negative offset is not sent.
+func (q *SearchQuery) Offset(offset int) *SearchQuery {
+	q.offset = offset
+	return q
+}
+
+// Limit sets the maximum number of results to return, 10 by default.
+// A limit lower than 1 is not sent.
+func (q *SearchQuery) Limit(limit int) *SearchQuery {
+	q.limit = limit
+	return q
+}
+
+// Err returns the first error encountered while building the query, if any.
+func (q *SearchQuery) Err() error {
+	return q.err
+}
+
+// Values returns the url parameters of the query.
+func (q *SearchQuery) Values() url.Values {
+	v := url.Values{}
+	typeIDs := []int{}
+	for typeID := range q.terms {
+		typeIDs = append(typeIDs, typeID)
+	}
+	sort.Ints(typeIDs)
+	for _, typeID := range typeIDs {
+		for _, termID := range q.terms[typeID] {
+			v.Add(fmt.Sprintf("term[%d][]", typeID), fmt.Sprintf("%d", termID))
+		}
+	}
+	for _, ID := range q.categories {
+		v.Add("cid", fmt.Sprintf("%d", ID))
+	}
+	if q.offset >= 0 {
+		v.Add("offset", fmt.Sprintf("%d", q.offset))
+	}
+	if q.limit > 0 {
+		v.Add("limit", fmt.Sprintf("%d", q.limit))
+	}
+	return v
+}
+
+// makeURL returns the url of the search request
+func (t *T411) makeURL(query *SearchQuery) (string, *url.URL, error) {
+	usedAPI := "/torrents/search/"
+	if query.err != nil {
+		return usedAPI, nil, query.err
+	}
+	u, err := url.Parse(fmt.Sprintf("%s%s%s", t.getBaseURL(), usedAPI, url.PathEscape(query.title)))
+	if err != nil {
+		return usedAPI, nil, err
+	}
+	u.RawQuery = query.Values().Encode()
+	return usedAPI, u, nil
+}
+
+// Search searches torrents using a query and returns a list of torrents
+// with a maximum of 10 torrents by default.
+func (t *T411) Search(query *SearchQuery) (*Torrents, error) {
+	return t.SearchContext(context.Background(), query)
+}
+
+// SearchContext does the same as Search using the
+// provided context for the underlying http requests.
+func (t *T411) SearchContext(ctx context.Context, query *SearchQuery) (*Torrents, error) {
+	usedAPI, u, err := t.makeURL(query)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.do(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	torrents := &Torrents{}
+	err = t.decode(ctx, torrents, resp, usedAPI, u.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+	if torrents.Dropped != 0 {
+		t.logger.Printf("Dropped %d invalid torrents using '%s' API for '%s' query", torrents.Dropped, usedAPI, u.RawQuery)
+	}
+	return torrents, nil
+}
@@ -0,0 +1,63 @@
+package t411client
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestSearchQuery(c *C) {
+	query := NewSearchQuery("vikings")
+	c.Assert(query.Values().Encode(), Equals, "")
+
+	query = NewSearchQuery("vikings").
+		Season(2).
+		Episode(3).
+		Languages("vostfr", "MULTI-FR", "vostfr").
+		Qualities("Web-Dl 720", "Web-Dl 1080").
+		Term(9, 22).
+		Categories(433, 637).
+		Offset(20).
+		Limit(50)
+	c.Assert(query.Err(), IsNil)
+	c.Assert(query.Values().Encode(), Equals, "cid=433&cid=637&limit=50&offset=20"+
+		"&term%5B45%5D%5B%5D=969&term%5B46%5D%5B%5D=939"+
+		"&term%5B51%5D%5B%5D=1216&term%5B51%5D%5B%5D=1212"+
+		"&term%5B7%5D%5B%5D=1175&term%5B7%5D%5B%5D=1174"+
+		"&term%5B9%5D%5B%5D=22")
+
+	query = NewSearchQuery("vikings").Season(31).Languages("klingon").Qualities("VHS")
+	c.Assert(query.Err(), ErrorIs, ErrInvalidQuery)
+	c.Assert(query.Err(), ErrorMatches, "invalid search query: unknown season 31")
+	c.Assert(NewSearchQuery("vikings").Episode(61).Err(), ErrorMatches, "invalid search query: unknown episode 61")
+	c.Assert(NewSearchQuery("vikings").Languages("klingon").Err(), ErrorMatches, `invalid search query: unknown language "klingon"`)
+	c.Assert(NewSearchQuery("vikings").Qualities("VHS").Err(), ErrorMatches, `invalid search query: unknown quality "VHS"`)
+
+	t411 := newEmptyClient("", "", "")
+	_, u, err := t411.makeURL(NewSearchQuery("what? 50/50 #1").Limit(5))
+	c.Assert(err, IsNil)
+	c.Assert(u.String(), Equals, t411BaseURL+"/torrents/search/what%3F%2050%2F50%20%231?limit=5")
+	_, _, err = t411.makeURL(query)
+	c.Assert(err, ErrorIs, ErrInvalidQuery)
+}
+
+func (s *MySuite) TestSearch(c *C) {
+	t411, _, _ := s.createT411Client(c)
+	torrents, err := t411.Search(NewSearchQuery("vikings").Season(1).Episode(1).Languages("vostfr", "english").Limit(20))
+	c.Assert(err, IsNil)
+	c.Assert(torrents.Torrents, HasLen, 11)
+	torrents, err = t411.Search(NewSearchQuery("vikings").Season(1).Episode(1).Languages("vostfr", "french").Limit(20))
+	c.Assert(err, IsNil)
+	c.Assert(torrents.Torrents, HasLen, 12)
+	torrents, err = t411.Search(NewSearchQuery("vikings").Season(1).Episode(1).Languages("vostfr", "quebecker ").Qualities("TVrip [Rip SD (non HD) depuis Source Tv HD/SD]"))
+	c.Assert(err, IsNil)
+	c.Assert(torrents.Torrents, HasLen, 0)
+
+	torrents, err = t411.Search(NewSearchQuery("stargate").Categories(433))
+	c.Assert(err, IsNil)
+	c.Assert(torrents.Torrents, HasLen, 0)
+	torrents, err = t411.Search(NewSearchQuery("vikings").Season(1).Categories(433, 637))
+	c.Assert(err, IsNil)
+	c.Assert(torrents.Total, Equals, "12")
+
+	_, err = t411.Search(NewSearchQuery("vikings").Languages("klingon"))
+	c.Assert(err, ErrorIs, ErrInvalidQuery)
+}
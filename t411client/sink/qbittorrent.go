@@ -0,0 +1,195 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// QBittorrent is a TorrentSink adding torrents through the qBittorrent Web API.
+// It logs in on the first request and again whenever the session expires.
+// It is safe for concurrent use.
+type QBittorrent struct {
+	// URL is the address of the Web UI, usually http://host:8080.
+	URL      string
+	Username string
+	Password string
+	// SavePath is the directory the content is downloaded to,
+	// the default directory of the client is used if empty.
+	SavePath string
+	// Category is the category of the added torrents, if any.
+	Category string
+	// Paused adds the torrents without starting them. Both the 'paused' field
+	// and the 'stopped' one replacing it since qBittorrent 5 are sent.
+	Paused bool
+	// Client is the http client used for the requests, http.DefaultClient if nil.
+	// The session cookie is kept in a jar of its own whatever the client.
+	Client *http.Client
+
+	mu     sync.Mutex
+	client *http.Client
+	logged bool
+}
+
+// NewQBittorrent creates a qBittorrent sink for the Web UI at 'url'.
+func NewQBittorrent(url, username, password string) *QBittorrent {
+	return &QBittorrent{
+		URL:      url,
+		Username: username,
+		Password: password,
+	}
+}
+
+// Add implements the TorrentSink interface.
+func (q *QBittorrent) Add(ctx context.Context, name string, torrent []byte) error {
+	body, contentType, err := q.addForm(name, torrent)
+	if err != nil {
+		return err
+	}
+	for retry := false; ; retry = true {
+		err = q.login(ctx)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, q.endpoint("/api/v2/torrents/add"), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Referer", q.referer())
+		resp, err := q.session().Do(req)
+		if err != nil {
+			return err
+		}
+		data, err := readBody(resp)
+		if err != nil {
+			return err
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if strings.TrimSpace(string(data)) == "Fails." {
+				return fmt.Errorf("%w: %s", ErrRejected, name)
+			}
+			return nil
+		case http.StatusUnsupportedMediaType:
+			return fmt.Errorf("%w: %s: invalid torrent file", ErrRejected, name)
+		case http.StatusForbidden:
+			// the session has expired, log in again once
+			q.logout()
+			if !retry {
+				continue
+			}
+		}
+		return statusError(resp, data)
+	}
+}
+
+func (q *QBittorrent) addForm(name string, torrent []byte) ([]byte, string, error) {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	part, err := form.CreateFormFile("torrents", name)
+	if err != nil {
+		return nil, "", err
+	}
+	_, err = part.Write(torrent)
+	if err != nil {
+		return nil, "", err
+	}
+	fields := map[string]string{
+		"savepath": q.SavePath,
+		"category": q.Category,
+	}
+	if q.Paused {
+		fields["paused"] = "true"
+		fields["stopped"] = "true"
+	}
+	for _, key := range []string{"savepath", "category", "paused", "stopped"} {
+		if len(fields[key]) == 0 {
+			continue
+		}
+		err = form.WriteField(key, fields[key])
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	err = form.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	return body.Bytes(), form.FormDataContentType(), nil
+}
+
+// login retrieves a session cookie unless already logged in.
+func (q *QBittorrent) login(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.logged {
+		return nil
+	}
+	form := url.Values{}
+	form.Set("username", q.Username)
+	form.Set("password", q.Password)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, q.endpoint("/api/v2/auth/login"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Referer", q.referer())
+	resp, err := q.sessionLocked().Do(req)
+	if err != nil {
+		return err
+	}
+	data, err := readBody(resp)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w: too many failed attempts", ErrAuth)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp, data)
+	}
+	if strings.TrimSpace(string(data)) != "Ok." {
+		return ErrAuth
+	}
+	q.logged = true
+	return nil
+}
+
+func (q *QBittorrent) logout() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.logged = false
+}
+
+func (q *QBittorrent) session() *http.Client {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.sessionLocked()
+}
+
+// sessionLocked returns a copy of the http client with a cookie jar.
+func (q *QBittorrent) sessionLocked() *http.Client {
+	if q.client == nil {
+		client := *httpClient(q.Client)
+		// cookiejar.New never fails without options
+		client.Jar, _ = cookiejar.New(nil)
+		q.client = &client
+	}
+	return q.client
+}
+
+// referer returns the Referer header expected by the CSRF protection of qBittorrent.
+func (q *QBittorrent) referer() string {
+	return strings.TrimSuffix(q.URL, "/")
+}
+
+func (q *QBittorrent) endpoint(path string) string {
+	return strings.TrimSuffix(q.URL, "/") + path
+}
@@ -0,0 +1,158 @@
+package sink
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+// fakeQBittorrent mimics the login and add endpoints of the qBittorrent Web API.
+type fakeQBittorrent struct {
+	*httptest.Server
+	mu       sync.Mutex
+	sessions map[string]bool
+	logins   int
+	added    map[string]map[string]string
+}
+
+func newFakeQBittorrent() *fakeQBittorrent {
+	f := &fakeQBittorrent{
+		sessions: map[string]bool{},
+		added:    map[string]map[string]string{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/auth/login", f.login)
+	mux.HandleFunc("/api/v2/torrents/add", f.add)
+	f.Server = httptest.NewServer(mux)
+	return f
+}
+
+// expire ends all the sessions.
+func (f *fakeQBittorrent) expire() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessions = map[string]bool{}
+}
+
+func (f *fakeQBittorrent) login(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method != http.MethodPost || r.Header.Get("Referer") != f.URL {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.FormValue("username") != "admin" || r.FormValue("password") != "secret" {
+		w.Write([]byte("Fails."))
+		return
+	}
+	f.logins++
+	sid := strings.Repeat("s", f.logins)
+	f.sessions[sid] = true
+	http.SetCookie(w, &http.Cookie{Name: "SID", Value: sid, Path: "/"})
+	w.Write([]byte("Ok."))
+}
+
+func (f *fakeQBittorrent) add(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cookie, err := r.Cookie("SID")
+	if err != nil || !f.sessions[cookie.Value] {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	file, header, err := r.FormFile("torrents")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	torrent, err := ioutil.ReadAll(file)
+	if err != nil || len(torrent) == 0 || torrent[0] != 'd' {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	f.added[header.Filename] = map[string]string{
+		"torrent":  string(torrent),
+		"savepath": r.FormValue("savepath"),
+		"category": r.FormValue("category"),
+		"paused":   r.FormValue("paused"),
+		"stopped":  r.FormValue("stopped"),
+	}
+	w.Write([]byte("Ok."))
+}
+
+func (s *MySuite) TestQBittorrent(c *C) {
+	fake := newFakeQBittorrent()
+	defer fake.Close()
+	sink := NewQBittorrent(fake.URL+"/", "admin", "secret")
+	sink.SavePath = "/downloads"
+	sink.Category = "series"
+
+	err := sink.Add(context.Background(), "test.torrent", testTorrent)
+	c.Assert(err, IsNil)
+	c.Assert(fake.logins, Equals, 1)
+	c.Assert(fake.added, DeepEquals, map[string]map[string]string{
+		"test.torrent": {
+			"torrent":  string(testTorrent),
+			"savepath": "/downloads",
+			"category": "series",
+			"paused":   "",
+			"stopped":  "",
+		},
+	})
+
+	// the session is reused
+	sink.Paused = true
+	err = sink.Add(context.Background(), "other.torrent", testTorrent)
+	c.Assert(err, IsNil)
+	c.Assert(fake.logins, Equals, 1)
+	c.Assert(fake.added["other.torrent"]["paused"], Equals, "true")
+	c.Assert(fake.added["other.torrent"]["stopped"], Equals, "true")
+
+	// and renewed once expired
+	fake.expire()
+	err = sink.Add(context.Background(), "test.torrent", testTorrent)
+	c.Assert(err, IsNil)
+	c.Assert(fake.logins, Equals, 2)
+
+	err = sink.Add(context.Background(), "invalid.torrent", []byte("invalid"))
+	c.Assert(err, ErrorIs, ErrRejected)
+	c.Assert(err.Error(), Equals, "sink: torrent rejected: invalid.torrent: invalid torrent file")
+
+	sink = NewQBittorrent(fake.URL, "admin", "wrong")
+	err = sink.Add(context.Background(), "test.torrent", testTorrent)
+	c.Assert(err, ErrorIs, ErrAuth)
+	c.Assert(fake.logins, Equals, 2)
+}
+
+func (s *MySuite) TestQBittorrentErrors(c *C) {
+	// the add request keeps being forbidden after a new login
+	logins := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		logins++
+		w.Write([]byte("Ok."))
+	})
+	mux.HandleFunc("/api/v2/torrents/add", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	err := NewQBittorrent(server.URL, "admin", "secret").Add(context.Background(), "test.torrent", testTorrent)
+	c.Assert(err, DeepEquals, &StatusError{StatusCode: http.StatusForbidden, Body: "Forbidden"})
+	c.Assert(logins, Equals, 2)
+
+	// the IP is banned after too many failed logins
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	err = NewQBittorrent(server.URL, "admin", "secret").Add(context.Background(), "test.torrent", testTorrent)
+	c.Assert(err, ErrorIs, ErrAuth)
+	c.Assert(err.Error(), Equals, "sink: authentication failed: too many failed attempts")
+}
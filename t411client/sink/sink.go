@@ -0,0 +1,64 @@
+// Package sink hands torrent files over to BitTorrent clients.
+//
+// Sinks are provided for the Transmission RPC, the qBittorrent Web API
+// and for clients watching a folder for new torrent files.
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrAuth is returned when the BitTorrent client rejects the credentials.
+	ErrAuth = errors.New("sink: authentication failed")
+	// ErrRejected is returned when the BitTorrent client refuses the torrent.
+	ErrRejected = errors.New("sink: torrent rejected")
+)
+
+// maxResponseSize is the maximum size of the responses read from the clients.
+const maxResponseSize = 1 << 20
+
+// TorrentSink is the interface implemented by the destinations of downloaded torrents.
+// 'name' is the name of the torrent file and 'torrent' its content.
+type TorrentSink interface {
+	Add(ctx context.Context, name string, torrent []byte) error
+}
+
+// StatusError represents an unexpected http status returned by a BitTorrent client.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if len(e.Body) == 0 {
+		return fmt.Sprintf("sink: unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("sink: unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+func httpClient(client *http.Client) *http.Client {
+	if client != nil {
+		return client
+	}
+	return http.DefaultClient
+}
+
+// readBody reads and closes the body of 'resp', up to maxResponseSize bytes.
+func readBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
+
+func statusError(resp *http.Response, body []byte) error {
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(body)),
+	}
+}
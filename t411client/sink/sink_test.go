@@ -0,0 +1,37 @@
+package sink
+
+import (
+	"errors"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type MySuite struct{}
+
+var _ = Suite(&MySuite{})
+
+type errorIsChecker struct {
+	*CheckerInfo
+}
+
+// ErrorIs checks whether an error matches a target error using errors.Is.
+var ErrorIs Checker = &errorIsChecker{
+	&CheckerInfo{Name: "ErrorIs", Params: []string{"obtained", "target"}},
+}
+
+func (checker *errorIsChecker) Check(params []interface{}, names []string) (bool, string) {
+	err, ok := params[0].(error)
+	if !ok {
+		return false, "obtained value is not an error"
+	}
+	target, ok := params[1].(error)
+	if !ok {
+		return false, "target value is not an error"
+	}
+	return errors.Is(err, target), ""
+}
+
+var testTorrent = []byte("d4:infod4:name4:testee")
@@ -0,0 +1,137 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// transmissionSessionHeader is the header holding the CSRF token of the Transmission RPC.
+const transmissionSessionHeader = "X-Transmission-Session-Id"
+
+// Transmission is a TorrentSink adding torrents through the Transmission RPC.
+// It is safe for concurrent use.
+type Transmission struct {
+	// URL is the address of the RPC endpoint, usually http://host:9091/transmission/rpc.
+	URL string
+	// Username and Password are used for basic authentication if Username is set.
+	Username string
+	Password string
+	// DownloadDir is the directory the content is downloaded to,
+	// the default directory of the client is used if empty.
+	DownloadDir string
+	// Paused adds the torrents without starting them.
+	Paused bool
+	// Client is the http client used for the requests, http.DefaultClient if nil.
+	Client *http.Client
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+// NewTransmission creates a Transmission sink for the RPC endpoint at 'url'.
+func NewTransmission(url string) *Transmission {
+	return &Transmission{
+		URL: url,
+	}
+}
+
+type transmissionRequest struct {
+	Method    string      `json:"method"`
+	Arguments interface{} `json:"arguments"`
+}
+
+type transmissionAdd struct {
+	Metainfo    string `json:"metainfo"`
+	DownloadDir string `json:"download-dir,omitempty"`
+	Paused      bool   `json:"paused,omitempty"`
+}
+
+type transmissionResponse struct {
+	Result string `json:"result"`
+}
+
+// Add implements the TorrentSink interface. Adding a torrent already
+// known by Transmission is not an error.
+func (t *Transmission) Add(ctx context.Context, name string, torrent []byte) error {
+	body, err := json.Marshal(&transmissionRequest{
+		Method: "torrent-add",
+		Arguments: &transmissionAdd{
+			Metainfo:    base64.StdEncoding.EncodeToString(torrent),
+			DownloadDir: t.DownloadDir,
+			Paused:      t.Paused,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	data, err := t.post(ctx, body)
+	if err != nil {
+		return err
+	}
+	response := &transmissionResponse{}
+	err = json.Unmarshal(data, response)
+	if err != nil {
+		return fmt.Errorf("sink: invalid transmission response: %w", err)
+	}
+	if response.Result != "success" {
+		return fmt.Errorf("%w: %s: %s", ErrRejected, name, response.Result)
+	}
+	return nil
+}
+
+// post sends an RPC request, doing the session id handshake if needed:
+// Transmission answers 409 with a new session id to use when it is missing or outdated.
+func (t *Transmission) post(ctx context.Context, body []byte) ([]byte, error) {
+	for handshake := false; ; handshake = true {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if len(t.Username) != 0 {
+			req.SetBasicAuth(t.Username, t.Password)
+		}
+		sessionID := t.getSessionID()
+		if len(sessionID) != 0 {
+			req.Header.Set(transmissionSessionHeader, sessionID)
+		}
+		resp, err := httpClient(t.Client).Do(req)
+		if err != nil {
+			return nil, err
+		}
+		data, err := readBody(resp)
+		if err != nil {
+			return nil, err
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return data, nil
+		case http.StatusUnauthorized:
+			return nil, ErrAuth
+		case http.StatusConflict:
+			newID := resp.Header.Get(transmissionSessionHeader)
+			if !handshake && len(newID) != 0 {
+				t.setSessionID(newID)
+				continue
+			}
+		}
+		return nil, statusError(resp, data)
+	}
+}
+
+func (t *Transmission) getSessionID() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessionID
+}
+
+func (t *Transmission) setSessionID(sessionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sessionID = sessionID
+}
@@ -0,0 +1,139 @@
+package sink
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+// fakeTransmission mimics the torrent-add method of the Transmission RPC.
+type fakeTransmission struct {
+	mu        sync.Mutex
+	sessionID string
+	sessions  int
+	hits      int
+	added     map[string]transmissionAdd
+}
+
+func newFakeTransmission() *fakeTransmission {
+	return &fakeTransmission{
+		added: map[string]transmissionAdd{},
+	}
+}
+
+// expire changes the session id the client is expected to send.
+func (f *fakeTransmission) expire() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessions++
+	f.sessionID = fmt.Sprintf("session-%d", f.sessions)
+}
+
+func (f *fakeTransmission) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hits++
+	user, password, ok := r.BasicAuth()
+	if !ok || user != "admin" || password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if len(f.sessionID) == 0 || r.Header.Get(transmissionSessionHeader) != f.sessionID {
+		if len(f.sessionID) == 0 {
+			f.sessions++
+			f.sessionID = fmt.Sprintf("session-%d", f.sessions)
+		}
+		w.Header().Set(transmissionSessionHeader, f.sessionID)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	request := struct {
+		Method    string          `json:"method"`
+		Arguments transmissionAdd `json:"arguments"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Method != "torrent-add" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	torrent, err := base64.StdEncoding.DecodeString(request.Arguments.Metainfo)
+	result := map[string]interface{}{"result": "success", "arguments": map[string]interface{}{}}
+	if err != nil || len(torrent) == 0 || torrent[0] != 'd' {
+		result["result"] = "invalid or corrupt torrent file"
+	} else if _, ok := f.added[string(torrent)]; ok {
+		result["arguments"] = map[string]interface{}{"torrent-duplicate": map[string]interface{}{"id": 1}}
+	} else {
+		f.added[string(torrent)] = request.Arguments
+		result["arguments"] = map[string]interface{}{"torrent-added": map[string]interface{}{"id": 1}}
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+func (s *MySuite) TestTransmission(c *C) {
+	fake := newFakeTransmission()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	sink := NewTransmission(server.URL)
+	sink.Username = "admin"
+	sink.Password = "secret"
+	sink.DownloadDir = "/downloads"
+	sink.Paused = true
+
+	// the first request retrieves the session id
+	err := sink.Add(context.Background(), "test.torrent", testTorrent)
+	c.Assert(err, IsNil)
+	c.Assert(fake.hits, Equals, 2)
+	c.Assert(fake.added, DeepEquals, map[string]transmissionAdd{
+		string(testTorrent): {
+			Metainfo:    base64.StdEncoding.EncodeToString(testTorrent),
+			DownloadDir: "/downloads",
+			Paused:      true,
+		},
+	})
+
+	// duplicates are accepted
+	err = sink.Add(context.Background(), "test.torrent", testTorrent)
+	c.Assert(err, IsNil)
+	c.Assert(fake.hits, Equals, 3)
+
+	// the session id is renewed
+	fake.expire()
+	err = sink.Add(context.Background(), "other.torrent", []byte("d4:infod4:name5:otheree"))
+	c.Assert(err, IsNil)
+	c.Assert(fake.hits, Equals, 5)
+	c.Assert(fake.added, HasLen, 2)
+
+	err = sink.Add(context.Background(), "invalid.torrent", []byte("invalid"))
+	c.Assert(err, ErrorIs, ErrRejected)
+	c.Assert(err.Error(), Equals, "sink: torrent rejected: invalid.torrent: invalid or corrupt torrent file")
+
+	sink.Password = "wrong"
+	err = sink.Add(context.Background(), "test.torrent", testTorrent)
+	c.Assert(err, ErrorIs, ErrAuth)
+}
+
+func (s *MySuite) TestTransmissionErrors(c *C) {
+	// a 409 without session id is not retried
+	conflicts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conflicts++
+		http.Error(w, "conflict", http.StatusConflict)
+	}))
+	defer server.Close()
+	err := NewTransmission(server.URL).Add(context.Background(), "test.torrent", testTorrent)
+	c.Assert(err, DeepEquals, &StatusError{StatusCode: http.StatusConflict, Body: "conflict"})
+	c.Assert(conflicts, Equals, 1)
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>"))
+	}))
+	defer server.Close()
+	err = NewTransmission(server.URL).Add(context.Background(), "test.torrent", testTorrent)
+	c.Assert(err, ErrorMatches, "sink: invalid transmission response: .*")
+}
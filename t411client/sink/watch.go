@@ -0,0 +1,52 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dns-gh/t411-client/t411client/internal/atomicfile"
+)
+
+// defaultWatchFolderMode is the default permission of the files written by WatchFolder.
+const defaultWatchFolderMode os.FileMode = 0644
+
+// WatchFolder is a TorrentSink writing torrent files into a directory
+// watched by a BitTorrent client.
+type WatchFolder struct {
+	// Dir is the watched directory.
+	Dir string
+	// Mode is the permission of the written files, 0644 if zero.
+	Mode os.FileMode
+}
+
+// NewWatchFolder creates a WatchFolder sink writing into 'dir'.
+func NewWatchFolder(dir string) *WatchFolder {
+	return &WatchFolder{
+		Dir: dir,
+	}
+}
+
+// Add implements the TorrentSink interface. The file is written under a
+// hidden temporary name and renamed once complete, so that the client never
+// picks up a partial file. An existing file with the same name is replaced.
+func (w *WatchFolder) Add(ctx context.Context, name string, torrent []byte) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+	name = filepath.Base(filepath.Clean("/" + filepath.FromSlash(name)))
+	if name == string(filepath.Separator) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("%w: invalid file name %q", ErrRejected, name)
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ".torrent") {
+		name += ".torrent"
+	}
+	mode := w.Mode
+	if mode == 0 {
+		mode = defaultWatchFolderMode
+	}
+	return atomicfile.Write(filepath.Join(w.Dir, name), torrent, mode)
+}
@@ -0,0 +1,45 @@
+package sink
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestWatchFolder(c *C) {
+	dir := c.MkDir()
+	sink := NewWatchFolder(dir)
+	err := sink.Add(context.Background(), "test.torrent", testTorrent)
+	c.Assert(err, IsNil)
+	// the extension is added and paths are stripped
+	err = sink.Add(context.Background(), "../other", testTorrent)
+	c.Assert(err, IsNil)
+	sink.Mode = 0600
+	err = sink.Add(context.Background(), "test.torrent", []byte("d4:infod4:name5:otheree"))
+	c.Assert(err, IsNil)
+
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 2)
+	c.Assert(files[0].Name(), Equals, "other.torrent")
+	c.Assert(files[0].Mode(), Equals, os.FileMode(0644))
+	c.Assert(files[1].Name(), Equals, "test.torrent")
+	c.Assert(files[1].Mode(), Equals, os.FileMode(0600))
+	data, err := ioutil.ReadFile(filepath.Join(dir, "test.torrent"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "d4:infod4:name5:otheree")
+
+	for _, name := range []string{"", "/", ".hidden.torrent"} {
+		err = sink.Add(context.Background(), name, testTorrent)
+		c.Assert(err, ErrorIs, ErrRejected, Commentf("name %q", name))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(sink.Add(ctx, "test.torrent", testTorrent), Equals, context.Canceled)
+	files, err = ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 2)
+}
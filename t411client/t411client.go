@@ -2,42 +2,46 @@ package t411client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
-	"net"
 	"net/http"
 	"net/url"
-	"regexp"
+	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
 var (
-	ErrNoToken       = errors.New("no token")
-	ErrURLParsing    = errors.New("url parsing error")
-	ErrWrongPassword = &errAPI{
+	ErrNoToken            = errors.New("no token")
+	ErrURLParsing         = errors.New("url parsing error")
+	ErrInvalidTokenFormat = errors.New("invalid token format, must be of the form 12345:123:abcdefghijklmnopqr")
+	ErrWrongPassword      = &APIError{
 		Code: 107,
 		Text: "Wrong password",
 	}
-	ErrAccountDisabled = &errAPI{
+	ErrAccountDisabled = &APIError{
 		Code: 103,
 		Text: "Account is disabled",
 	}
-	ErrUserNotFound = &errAPI{
+	ErrUserNotFound = &APIError{
 		Code: 101,
 		Text: "User not found",
 	}
-	ErrTokenExpired = &errAPI{
+	ErrTokenExpired = &APIError{
 		Code: 201,
 		Text: "Token has expired. Please login",
 	}
-	ErrTokenInvalid = &errAPI{
+	ErrTokenInvalid = &APIError{
 		Code: 202,
 		Text: "Invalid token",
 	}
+	// TokenAttempt was the error returned when a new token had been retrieved.
+	// Deprecated: requests are now replayed once with the new token and
+	// a *TokenRefreshError is returned if it fails.
 	TokenAttempt = "token retrieved, try again"
 )
 
@@ -45,21 +49,81 @@ var (
 const (
 	t411BaseURL = "https://api.t411.al"
 	authAPI     = "/auth"
-	// UserAgent is the user agent header used in http requests.
-	// You can override it if wanted when using t411client package.
+	// UserAgent is the default user agent header used in http requests.
+	// You can override it using the WithUserAgent option.
 	UserAgent    = "TBotAgent"
 	defaultDelay = 24 * 7 * 12 // 9 weeks
 )
 
-type errAPI struct {
-	Code int    `json:"code"`
-	Text string `json:"error"`
+// Endpoints of the t411 API, used to configure per-endpoint rate limits.
+// See WithEndpointRateLimit.
+const (
+	AuthEndpoint           = authAPI
+	UsersProfileEndpoint   = "/users/profile"
+	SearchEndpoint         = "/torrents/search"
+	DetailsEndpoint        = "/torrents/details"
+	DownloadEndpoint       = "/torrents/download"
+	CategoriesTreeEndpoint = "/categories/tree"
+	TermsTreeEndpoint      = "/terms/tree"
+)
+
+var endpoints = []string{
+	AuthEndpoint,
+	UsersProfileEndpoint,
+	SearchEndpoint,
+	DetailsEndpoint,
+	DownloadEndpoint,
+	CategoriesTreeEndpoint,
+	TermsTreeEndpoint,
+}
+
+// APIError represents an error returned by the t411 API.
+// Endpoint and HTTPStatus are set on errors returned by requests, so
+// errors.Is must be used to compare them with the exported API errors.
+type APIError struct {
+	Code       int    `json:"code"`
+	Text       string `json:"error"`
+	Endpoint   string `json:"-"`
+	HTTPStatus int    `json:"-"`
 }
 
-func (e *errAPI) Error() string {
+func (e *APIError) Error() string {
 	return fmt.Sprintf("%d: %s", e.Code, e.Text)
 }
 
+// Is reports whether the target is an *APIError with the same code.
+// Both 301 and 1301 codes mean 'torrent not found' and match each other.
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	if !ok {
+		return false
+	}
+	if e.Code == t.Code {
+		return true
+	}
+	return isTorrentNotFound(e.Code) && isTorrentNotFound(t.Code)
+}
+
+func isTokenError(err error) bool {
+	return errors.Is(err, ErrTokenExpired) || errors.Is(err, ErrTokenInvalid)
+}
+
+// TokenRefreshError is returned when a request failed because of an expired
+// or invalid token and that either retrieving a new token failed or the
+// request replayed with the new token failed the same way.
+type TokenRefreshError struct {
+	Err error
+}
+
+func (e *TokenRefreshError) Error() string {
+	return fmt.Sprintf("token refresh failed: %s", e.Err.Error())
+}
+
+// Unwrap returns the underlying error.
+func (e *TokenRefreshError) Unwrap() error {
+	return e.Err
+}
+
 // Credentials is the couple username password required by t411 API for authentification
 type Credentials struct {
 	Username string `json:"username"`
@@ -72,12 +136,35 @@ type token struct {
 	Token string `json:"token"`
 }
 
-// T411 represents the web client to the t411 API
+// T411 represents the web client to the t411 API.
+// It is safe for concurrent use by multiple goroutines.
 type T411 struct {
+	credentials Credentials
+	httpClient  *http.Client
+	userAgent   string
+	logger      Logger
+	tokenStore  TokenStore
+	terms       *TermResolver
+	cache       *diskCache
+	limiter     *rateLimiter
+	retry       RetryPolicy
+	// mirrors are the base urls to fail over to, in order
+	mirrors        []string
+	onMirrorSwitch func(from, to string)
+	fileMode       os.FileMode
+	collision      CollisionPolicy
+	ranker         Ranker
+	// metainfos are the metainfo of the last downloaded torrents by id
+	metainfos *metainfoCache
+	// maxRetryAfter is the longest Retry-After delay waited for
+	maxRetryAfter time.Duration
+	// refreshingMu protects refreshing, the token retrievals in flight by stale token
+	refreshingMu sync.Mutex
+	refreshing   map[string]*refreshCall
+	// mu protects the fields below
+	mu           sync.RWMutex
 	baseURL      string
 	token        *token
-	credentials  Credentials
-	httpClient   *http.Client
 	maxDelay     float64
 	keepRatio    bool
 	onlyVerified bool
@@ -85,16 +172,36 @@ type T411 struct {
 
 // GetToken returns the token retrieved from authentication, if any.
 func (t *T411) GetToken() (string, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	if t.token != nil {
 		return t.token.Token, nil
 	}
 	return "", ErrNoToken
 }
 
+// getToken returns a copy of the current token.
+func (t *T411) getToken() token {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.token != nil {
+		return *t.token
+	}
+	return token{}
+}
+
+func (t *T411) setToken(tok *token) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.token = tok
+}
+
 // SetMaxDelay sets the maximum delay allowed to have between
 // the release date of a show episode and the added date of a torrent
 // in the t411 tracker.
 func (t *T411) SetMaxDelay(maxDelay float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.maxDelay = maxDelay
 }
 
@@ -102,139 +209,218 @@ func (t *T411) SetMaxDelay(maxDelay float64) {
 // the release date of a show episode and the added date of a torrent
 // in the t411 tracker.
 func (t *T411) GetMaxDelay() float64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.maxDelay
 }
 
 // KeepRatio disables any download that could put the ratio below 1.
 // By default, keepRatio is set to true.
 func (t *T411) KeepRatio(keepRatio bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.keepRatio = keepRatio
 }
 
+func (t *T411) isKeepingRatio() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.keepRatio
+}
+
 // OnlyVerified enables download only of verified torrents.
 // By default, onlyVerified is set to false.
 func (t *T411) OnlyVerified(onlyVerified bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.onlyVerified = onlyVerified
 }
 
-func newEmptyClient(baseURL, username, password string) *T411 {
-	if len(baseURL) == 0 {
-		baseURL = t411BaseURL
-	}
-	var netTransport = &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout: 5 * time.Second,
-		}).Dial,
-		TLSHandshakeTimeout: 5 * time.Second,
-	}
-	return &T411{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout:   time.Second * 10,
-			Transport: netTransport,
-		},
-		credentials: Credentials{
-			Username: username,
-			Password: password,
-		},
+func (t *T411) isOnlyVerified() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.onlyVerified
+}
+
+func newClient(o *options) *T411 {
+	t := &T411{
+		baseURL:      strings.TrimSuffix(o.baseURL, "/"),
+		httpClient:   o.newHTTPClient(),
+		userAgent:    o.userAgent,
+		logger:       o.logger,
+		tokenStore:   o.tokenStore,
+		credentials:  o.credentials,
 		token:        &token{},
-		maxDelay:     defaultDelay,
-		keepRatio:    true,
-		onlyVerified: false,
+		metainfos:    newMetainfoCache(maxCachedMetainfos),
+		maxDelay:     o.maxDelay,
+		keepRatio:    o.keepRatio,
+		onlyVerified: o.onlyVerified,
+	}
+	t.limiter = newRateLimiter(o.rateLimit, o.endpointRateLimits)
+	t.maxRetryAfter = o.maxRetryAfter
+	t.retry = o.retry
+	t.mirrors = o.mirrorList()
+	t.onMirrorSwitch = o.onMirrorSwitch
+	t.fileMode = o.fileMode
+	t.collision = o.collision
+	t.ranker = o.ranker
+	if len(o.cacheDir) != 0 {
+		t.cache = &diskCache{
+			dir: o.cacheDir,
+			ttl: o.cacheTTL,
+		}
+	}
+	if o.termsTTL > 0 {
+		t.terms = NewTermResolver(t, o.termsTTL)
 	}
+	return t
 }
 
-// NewT411Client creates a T411 web client.
-// Note: 'baseURL' is set to the default one if left empty.
-// This parameter will be useful when the baseURL of t411 API becomes unavailable.
-func NewT411Client(baseURL, username, password string) (*T411, error) {
-	client := newEmptyClient(baseURL, username, password)
-	err := client.retrieveToken()
-	if err != nil {
-		return nil, err
-	}
-	return client, nil
+func newEmptyClient(baseURL, username, password string) *T411 {
+	return newClient(newOptions(WithBaseURL(baseURL), WithCredentials(username, password)))
 }
 
-// NewT411ClientWithToken creates a T411 web client the same way NewT411Client does
-// but with a token parameter from a previous session. If the token is in invalid format it returns an error.
-func NewT411ClientWithToken(baseURL, username, password, previousToken string) (*T411, error) {
-	if len(previousToken) == 0 {
-		return NewT411Client(baseURL, username, password)
+// New creates a T411 web client configured with the given options.
+// If no token is set with WithToken or found in the token store, a new one is
+// retrieved using the credentials. Otherwise the token format is checked and the
+// token is validated by requesting the user profile, a new one being retrieved
+// automatically if it has expired.
+func New(opts ...Option) (*T411, error) {
+	o := newOptions(opts...)
+	client := newClient(o)
+	if len(o.token) == 0 && o.tokenStore != nil {
+		token, err := o.tokenStore.Load()
+		if err != nil {
+			return nil, err
+		}
+		if len(strings.Split(token, ":")) == 3 {
+			o.token = token
+		} else if len(token) != 0 {
+			client.logger.Printf("Ignoring stored token: %s", ErrInvalidTokenFormat.Error())
+		}
+	}
+	if len(o.token) == 0 {
+		err := client.retrieveToken(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
 	}
-	splitted := strings.Split(previousToken, ":")
+	splitted := strings.Split(o.token, ":")
 	if len(splitted) != 3 {
-		return nil, fmt.Errorf("%s", "invalid token format, must be of the form 12345:123:abcdefghijklmnopqr")
+		return nil, ErrInvalidTokenFormat
 	}
-	client := newEmptyClient(baseURL, username, password)
-	client.token.Token = previousToken
+	client.token.Token = o.token
 	client.token.UID = splitted[0]
 	_, err := client.UsersProfile(client.token.UID)
 	if err != nil {
-		if strings.Contains(err.Error(), TokenAttempt) {
-			return client, nil
-		}
-		return nil, fmt.Errorf("%s", err.Error())
+		return nil, err
 	}
 	return client, nil
 }
 
-func (t *T411) doRequest(req *http.Request) (*http.Response, error) {
-	if len(t.token.Token) != 0 {
-		req.Header.Set("Authorization", t.token.Token)
-	} else {
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	}
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", UserAgent)
-	return t.httpClient.Do(req)
+// NewT411Client creates a T411 web client.
+// Note: 'baseURL' is set to the default one if left empty.
+// This parameter will be useful when the baseURL of t411 API becomes unavailable.
+// It is equivalent to New(WithBaseURL(baseURL), WithCredentials(username, password)).
+func NewT411Client(baseURL, username, password string) (*T411, error) {
+	return New(WithBaseURL(baseURL), WithCredentials(username, password))
 }
 
-func (t *T411) do(method string, u *url.URL, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequest(method, u.String(), body)
-	if err != nil {
-		return nil, err
+// NewT411ClientWithToken creates a T411 web client the same way NewT411Client does
+// but with a token parameter from a previous session. If the token is in invalid format it returns an error.
+// It is equivalent to New(WithBaseURL(baseURL), WithCredentials(username, password), WithToken(previousToken)).
+func NewT411ClientWithToken(baseURL, username, password, previousToken string) (*T411, error) {
+	return New(WithBaseURL(baseURL), WithCredentials(username, password), WithToken(previousToken))
+}
+
+// doRequest does the request once the rate limits of its endpoint allow it.
+// If the API answers with a 429 or 503 status code and a Retry-After header,
+// the endpoint is paused accordingly and the request is sent again once,
+// provided the delay does not exceed the maximum one. See WithMaxRetryAfter.
+func (t *T411) doRequest(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", t.userAgent)
+	endpoint := t.endpoint(req.URL)
+	for retried := false; ; retried = true {
+		err := t.limiter.wait(req.Context(), endpoint)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := t.doMirrored(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+			return resp, nil
+		}
+		delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			return resp, nil
+		}
+		resp.Body.Close()
+		t.limiter.pause(endpoint, delay)
+		throttled := fmt.Errorf("%w: '%s' API asked to retry after %s", ErrThrottled, endpoint, delay)
+		if retried || delay > t.maxRetryAfter {
+			return nil, throttled
+		}
+		req, err = rewindRequest(req)
+		if err != nil {
+			return nil, throttled
+		}
+		t.logger.Printf("Throttled using '%s' API, retrying in %s", endpoint, delay)
 	}
+}
 
-	resp, err := t.doRequest(req)
+func (t *T411) do(ctx context.Context, method string, u *url.URL, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
 	if err != nil {
 		return nil, err
 	}
-	return resp, nil
+	return t.doAuthorized(req)
 }
 
-func fixTorrentList(str, expression, replacement string) (string, bool) {
-	re := regexp.MustCompile(expression)
-	split := re.Split(str, -1)
-	if len(split) >= 2 {
-		str = strings.Join(split, replacement)
-		return str, true
+// doAuthorized does the request with the current token, if any.
+// GET requests failing transiently are sent again according to the
+// retry policy of the client, see WithRetryPolicy, their body being
+// read beforehand so that truncated ones are retried too.
+func (t *T411) doAuthorized(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if req.Method == "GET" {
+		attempts = t.retry.MaxAttempts
 	}
-	return str, false
-}
-
-// fixJSONResponse fixes the json response for /torrents/search/ api endpoint for the fields
-// offset, limit, total and owner.
-func fixJSONResponse(bytes []byte) []byte {
-	str := string(bytes)
-	str = strings.Replace(str, fmt.Sprintf("%q:0", "offset"), fmt.Sprintf("%q:%q", "offset", "0"), 1)
-	str = strings.Replace(str, fmt.Sprintf("%q:10", "limit"), fmt.Sprintf("%q:%q", "limit", "10"), 1)
-	str = strings.Replace(str, fmt.Sprintf("%q:0", "total"), fmt.Sprintf("%q:%q", "total", "0"), 1)
-	str = strings.Replace(str, fmt.Sprintf("%q:0", "owner"), fmt.Sprintf("%q:%q", "owner", "0"), 1)
-	// removes unwanted integers in the list of torrents that appears sometimes
-	// and replace them with empty Torrent data.
-	str, _ = fixTorrentList(str, ":\\[[0-9]+,", ":[{},")
-	str, _ = fixTorrentList(str, ",[0-9]+\\]}", ",{}]}")
-	str, _ = fixTorrentList(str, ":\\[[0-9]+\\]}", ":[{}]}")
-	for {
-		str, ok := fixTorrentList(str, ",[0-9]+,", ",{},")
-		if !ok {
-			return []byte(str)
+	for attempt := 1; ; attempt++ {
+		if tok := t.getToken(); len(tok.Token) != 0 {
+			req.Header.Set("Authorization", tok.Token)
+		}
+		resp, err := t.doRequest(req)
+		if err == nil && attempts > 1 {
+			err = bufferBody(resp)
+		}
+		if attempt >= attempts || req.Context().Err() != nil || !t.retry.retryable(resp, err) {
+			if err != nil {
+				if resp != nil {
+					resp.Body.Close()
+				}
+				return nil, err
+			}
+			return resp, nil
+		}
+		delay := t.retry.backoff(attempt)
+		t.logger.Printf("Request to '%s' failed (attempt %d/%d), retrying in %s: %s",
+			t.endpoint(req.URL), attempt, attempts, delay, describeFailure(resp, err))
+		if resp != nil {
+			resp.Body.Close()
 		}
+		err = sleepContext(req.Context(), delay)
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
 	}
 }
 
-func decodeErr(resp *http.Response) ([]byte, error) {
+func decodeErr(resp *http.Response, usedAPI string) ([]byte, error) {
 	// resp.ContentLength not set properly from server side ?
 	buf := bytes.NewBuffer(make([]byte, 0 /*, resp.ContentLength */))
 	_, err := buf.ReadFrom(resp.Body)
@@ -245,35 +431,55 @@ func decodeErr(resp *http.Response) ([]byte, error) {
 
 	// authentication and other requests can fails with StatusCode = 200...
 	// so do not check for the status code value, instead try to
-	// unmarshal into an errAPI struct and check if there was an error.
-	errorAPI := &errAPI{}
+	// unmarshal into an APIError struct and check if there was an error.
+	errorAPI := &APIError{}
 	err = json.Unmarshal(bytes, errorAPI)
 	if err != nil {
 		return bytes, nil
 	}
 	if len(errorAPI.Text) != 0 {
+		errorAPI.Endpoint = usedAPI
+		errorAPI.HTTPStatus = resp.StatusCode
 		return nil, errorAPI
 	}
 	return bytes, nil
 }
 
-func (t *T411) decode(data interface{}, resp *http.Response, usedAPI, query string) error {
-	bytes, err := decodeErr(resp)
+// readResponse reads the response body and checks it for API errors.
+// For any requests, if it is a token expired or invalid response and that
+// we're not in an auth request already, then a new token is retrieved
+// automatically and the original request is replayed once with it.
+// The returned response is the replayed one if any, with its body already consumed.
+func (t *T411) readResponse(ctx context.Context, resp *http.Response, usedAPI string) (*http.Response, []byte, error) {
+	bytes, err := decodeErr(resp, usedAPI)
+	if !isTokenError(err) || usedAPI == authAPI {
+		return resp, bytes, err
+	}
+	t.logger.Printf("Token has something wrong: %s", err.Error())
+	err = t.refreshToken(ctx, resp.Request.Header.Get("Authorization"))
+	if err != nil {
+		return nil, nil, &TokenRefreshError{Err: err}
+	}
+	replay, err := t.do(ctx, resp.Request.Method, resp.Request.URL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer replay.Body.Close()
+
+	bytes, err = decodeErr(replay, usedAPI)
+	if isTokenError(err) {
+		return nil, nil, &TokenRefreshError{Err: err}
+	}
+	return replay, bytes, err
+}
+
+func (t *T411) decode(ctx context.Context, data interface{}, resp *http.Response, usedAPI, query string) error {
+	_, bytes, err := t.readResponse(ctx, resp, usedAPI)
 	if err != nil {
-		// for any requests, if it is a token expired response and that we're not in an auth request already
-		// then retrieve token automatically.
-		if (err.Error() == ErrTokenExpired.Error() || err.Error() == ErrTokenInvalid.Error()) && usedAPI != authAPI {
-			log.Printf("Token has something wrong: %s", err.Error())
-			err2 := t.retrieveToken()
-			if err2 != nil {
-				return fmt.Errorf("Token retrieved failed: %s", err2.Error())
-			}
-			return fmt.Errorf("%s", TokenAttempt)
-		}
 		return err
 	}
-	if err = json.Unmarshal(fixJSONResponse(bytes), data); err != nil {
-		log.Printf("Error decoding using '%s' API for '%s' query :%v", usedAPI, query, err)
+	if err = json.Unmarshal(bytes, data); err != nil {
+		t.logger.Printf("Error decoding using '%s' API for '%s' query :%v", usedAPI, query, err)
 		return err
 	}
 	return nil
@@ -282,9 +488,9 @@ func (t *T411) decode(data interface{}, resp *http.Response, usedAPI, query stri
 // retrieveToken does an authentification request on T411 API
 // and retrieve the token needed for further requests.
 // Note:the Time-To-Live of the token is 90 days.
-func (t *T411) retrieveToken() error {
+func (t *T411) retrieveToken(ctx context.Context) error {
 	usedAPI := authAPI
-	u, err := url.Parse(t.baseURL + usedAPI)
+	u, err := url.Parse(t.getBaseURL() + usedAPI)
 	if err != nil {
 		return err
 	}
@@ -292,17 +498,94 @@ func (t *T411) retrieveToken() error {
 	form := url.Values{}
 	form.Set("username", t.credentials.Username)
 	form.Set("password", t.credentials.Password)
-	// reset token since we want a new one potentially
-	t.token = &token{}
-	resp, err := t.do("POST", u, strings.NewReader(form.Encode()))
+	// the authentication request is done without any token
+	// since we want a new one potentially
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.doRequest(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	err = t.decode(t.token, resp, usedAPI, "")
+	tok := &token{}
+	err = t.decode(ctx, tok, resp, usedAPI, "")
 	if err != nil {
 		return err
 	}
+	t.setToken(tok)
+	if t.tokenStore != nil {
+		err = t.tokenStore.Save(tok.Token)
+		if err != nil {
+			t.logger.Printf("Error saving token: %v", err)
+		}
+	}
 	return nil
 }
+
+// refreshCall represents a token retrieval shared by the requests
+// that failed because of the same stale token.
+type refreshCall struct {
+	done chan struct{}
+	err  error
+	// interrupted is set if the retrieval failed because of the context
+	// of a caller rather than because of the authentication itself
+	interrupted bool
+}
+
+// refreshToken retrieves a new token unless the 'stale' one used by a failed
+// request has already been replaced in the meantime, so that concurrent requests
+// failing because of the same token trigger a single authentication request
+// and all get its outcome, error included. The authentication request is not
+// bound to the context of any of them: each one stops waiting once its own
+// context is done while the others keep on waiting for the new token.
+func (t *T411) refreshToken(ctx context.Context, stale string) error {
+	for {
+		t.refreshingMu.Lock()
+		if t.getToken().Token != stale {
+			t.refreshingMu.Unlock()
+			return nil
+		}
+		call, ok := t.refreshing[stale]
+		if !ok {
+			if t.refreshing == nil {
+				t.refreshing = map[string]*refreshCall{}
+			}
+			call = &refreshCall{done: make(chan struct{})}
+			t.refreshing[stale] = call
+			go t.runRefresh(ctx, stale, call)
+		}
+		t.refreshingMu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		// an interrupted refresh is not the outcome of the
+		// authentication, it is retried if the caller can still wait
+		if !call.interrupted || ctx.Err() != nil {
+			return call.err
+		}
+	}
+}
+
+// runRefresh retrieves a new token for the 'call' refreshing the 'stale' one,
+// within the time limit of the http client but regardless of 'ctx' being done.
+func (t *T411) runRefresh(ctx context.Context, stale string, call *refreshCall) {
+	timeout := t.httpClient.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+	call.err = t.retrieveToken(ctx)
+	call.interrupted = ctx.Err() == nil &&
+		(errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded))
+	t.refreshingMu.Lock()
+	delete(t.refreshing, stale)
+	t.refreshingMu.Unlock()
+	close(call.done)
+}
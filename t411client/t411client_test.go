@@ -1,65 +1,176 @@
 package t411client
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/dns-gh/t411-client/t411client/t411test"
 	. "gopkg.in/check.v1"
 )
 
 func Test(t *testing.T) { TestingT(t) }
 
-type MySuite struct{}
+type MySuite struct {
+	server *t411test.Server
+}
 
 var _ = Suite(&MySuite{})
 
-func getCredentials(c *C) (string, string) {
-	username, password := os.Getenv("T411_USERNAME"), os.Getenv("T411_PASSWORD")
-	c.Assert(username, Not(HasLen), 0)
-	c.Assert(password, Not(HasLen), 0)
-	return username, password
+type errorIsChecker struct {
+	*CheckerInfo
+}
+
+// ErrorIs checks whether an error matches a target error using errors.Is.
+var ErrorIs Checker = &errorIsChecker{
+	&CheckerInfo{Name: "ErrorIs", Params: []string{"obtained", "target"}},
+}
+
+func (checker *errorIsChecker) Check(params []interface{}, names []string) (bool, string) {
+	err, ok := params[0].(error)
+	if !ok {
+		return false, "obtained value is not an error"
+	}
+	target, ok := params[1].(error)
+	if !ok {
+		return false, "target value is not an error"
+	}
+	return errors.Is(err, target), ""
+}
+
+const (
+	testUsername = "tbot"
+	testPassword = "secret"
+)
+
+// seedServer fills the fake t411 API with a user and some torrents.
+func seedServer(server *t411test.Server) {
+	server.AddUser(t411test.User{
+		UID:        "12345",
+		Username:   testUsername,
+		Password:   testPassword,
+		Downloaded: "1073741824",
+		Uploaded:   "10737418240",
+	})
+	server.AddUser(t411test.User{
+		Username: "test",
+		Password: "test",
+		Disabled: true,
+	})
+	vikings := func(id int, name, seeders string, terms ...int) t411test.Torrent {
+		return t411test.Torrent{
+			ID:            fmt.Sprint(id),
+			Name:          name,
+			Category:      "433",
+			Categoryname:  "Série TV",
+			Categoryimage: "video-tv-series",
+			Seeders:       seeders,
+			Leechers:      "2",
+			IsVerified:    "1",
+			Added:         "2013-03-04 10:00:00",
+			Size:          "367001600",
+			Owner:         "97237274",
+			Username:      "Niko0306",
+			Privacy:       "normal",
+			TermIDs:       terms,
+		}
+	}
+	first := vikings(4831500, "Vikings.S01E01.HDTV.x264.2HD.VOSTFR", "12", 968, 937, 1216, 12)
+	first.Rewritename = "vikings-s01e01-hdtv-x264-2hd-vostfr"
+	first.Description = "Vikings, saison 1, épisode 1"
+	first.Terms = map[string]string{
+		"Vidéo - Langue":    "VOSTFR",
+		"Vidéo - Qualité":   "TVripHD 720 [Rip HD depuis Source Tv HD]",
+		"Vidéo - Système":   "PC/Platine/Lecteur Multimédia/etc",
+		"Vidéo - Type":      "2D (Standard)",
+		"Vidéo - Genre":     "Historique",
+		"SérieTV - Episode": "Episode 01",
+		"SérieTV - Saison":  "Saison 01",
+		"Vidéo - Format":    "NTSC (23.9, 29.9 ou 60 Img/s)",
+	}
+	server.AddTorrent(first)
+	server.AddTorrent(vikings(4831501, "Vikings.S01E01.FRENCH.HDTV.x264-ATeam", "57", 968, 937, 1210, 11))
+	for i := 0; i < 10; i++ {
+		server.AddTorrent(vikings(4831502+i, fmt.Sprintf("Vikings.S01E01.VOSTFR.720p.HDTV.x264-GRP%d", i), fmt.Sprint(i), 968, 937, 1216, 12))
+	}
+	for i := 0; i < 580; i++ {
+		season, episode := i/20+2, i%20+1
+		server.AddTorrent(vikings(5000000+i, fmt.Sprintf("Vikings.S%02dE%02d.VOSTFR.HDTV.x264-GRP", season, episode), "1", 967+season, 936+episode))
+	}
+	server.AddTorrent(
+		t411test.Torrent{ID: "4000001", Name: "Stargate.SG-1.S01.FRENCH.DVDRip.XviD", Seeders: "5", TermIDs: []int{968, 936}},
+		t411test.Torrent{ID: "4000002", Name: "Stargate.SG-1.Integrale.FRENCH.DVDRip", Seeders: "8", TermIDs: []int{998, 936}},
+		t411test.Torrent{ID: "4000003", Name: "Stargate.SG-1.S01E01.FRENCH.DVDRip.XviD", Seeders: "3", TermIDs: []int{968, 937}},
+	)
+	for i := 0; i < 12; i++ {
+		server.AddTorrent(t411test.Torrent{ID: fmt.Sprint(3000000 + i), Name: fmt.Sprintf("Avatar.%d.FRENCH.DVDRip", 2009+i), Seeders: "20", TermIDs: []int{10}})
+	}
+}
+
+func (s *MySuite) SetUpTest(c *C) {
+	s.server = t411test.NewServer()
+	seedServer(s.server)
+}
+
+func (s *MySuite) TearDownTest(c *C) {
+	s.server.Close()
 }
 
-func createT411Client(c *C) (*T411, string, string) {
-	username, password := getCredentials(c)
-	t411, err := NewT411Client("", username, password)
+func (s *MySuite) createT411Client(c *C) (*T411, string, string) {
+	t411, err := NewT411Client(s.server.URL, testUsername, testPassword)
 	c.Assert(err, IsNil)
-	return t411, username, password
+	return t411, testUsername, testPassword
 }
 
-func checkClient(c *C, t411 *T411, username, password string) {
+func (s *MySuite) checkClient(c *C, t411 *T411, username, password string) {
 	t411Token, err := t411.GetToken()
 	c.Assert(err, IsNil)
 	c.Assert(t411Token, Not(HasLen), 0)
 	expected := &T411{
-		baseURL:    t411BaseURL,
+		baseURL:    s.server.URL,
 		httpClient: t411.httpClient,
+		userAgent:  UserAgent,
+		logger:     log.Default(),
 		credentials: Credentials{
 			Username: username,
 			Password: password,
 		},
-		token:     t411.token,
-		maxDelay:  336,
-		keepRatio: true,
+		token:         t411.token,
+		metainfos:     newMetainfoCache(maxCachedMetainfos),
+		limiter:       t411.limiter,
+		retry:         DefaultRetryPolicy,
+		maxRetryAfter: defaultMaxRetryAfter,
+		fileMode:      defaultFileMode,
+		ranker:        DefaultRanker,
+		maxDelay:      defaultDelay,
+		keepRatio:     true,
 	}
 	c.Assert(t411, DeepEquals, expected)
 }
 
-// export T411_USERNAME=YOUR_USERNAME && export T411_PASSWORD=YOUR_PASSWORD && go test ...t411client -gocheck.vv -test.v -gocheck.f TestNAME
+// go test ...t411client -gocheck.vv -test.v -gocheck.f TestNAME
 func (s *MySuite) TestNewT411(c *C) {
-	t411, username, password := createT411Client(c)
-	checkClient(c, t411, username, password)
+	t411, username, password := s.createT411Client(c)
+	s.checkClient(c, t411, username, password)
 
-	t411, err := NewT411Client("", username, "test")
-	c.Assert(err, DeepEquals, ErrWrongPassword)
+	t411, err := NewT411Client(s.server.URL, username, "test")
+	c.Assert(err, ErrorIs, ErrWrongPassword)
 	c.Assert(t411, IsNil)
 
-	t411, err = NewT411Client("", "test", "test")
-	c.Assert(err, DeepEquals, ErrAccountDisabled)
+	t411, err = NewT411Client(s.server.URL, "test", "test")
+	c.Assert(err, ErrorIs, ErrAccountDisabled)
 	c.Assert(t411, IsNil)
 
-	t411, err = NewT411Client("", "test_not_found", "test")
-	c.Assert(err, DeepEquals, ErrUserNotFound)
+	t411, err = NewT411Client(s.server.URL, "test_not_found", "test")
+	c.Assert(err, ErrorIs, ErrUserNotFound)
 	c.Assert(t411, IsNil)
 
 	t411, err = NewT411Client("https://api.t411.test", username, "test")
@@ -67,19 +178,215 @@ func (s *MySuite) TestNewT411(c *C) {
 }
 
 func (s *MySuite) TestNewT411WithToken(c *C) {
-	username, password := getCredentials(c)
-	t411, err := NewT411ClientWithToken("", username, password, "")
+	username, password := testUsername, testPassword
+	t411, err := NewT411ClientWithToken(s.server.URL, username, password, "")
 	c.Assert(err, IsNil)
-	checkClient(c, t411, username, password)
+	s.checkClient(c, t411, username, password)
 
 	token, err := t411.GetToken()
 	c.Assert(err, IsNil)
-	t411, err = NewT411ClientWithToken("", username, password, token)
+	t411, err = NewT411ClientWithToken(s.server.URL, username, password, token)
 	c.Assert(err, IsNil)
-	checkClient(c, t411, username, password)
+	s.checkClient(c, t411, username, password)
 	checkUser(c, t411, username)
 
-	t411, err = NewT411ClientWithToken("", username, password, "invalid")
+	s.server.ExpireTokens()
+	t411, err = NewT411ClientWithToken(s.server.URL, username, password, token)
+	c.Assert(err, IsNil)
+	newToken, err := t411.GetToken()
+	c.Assert(err, IsNil)
+	c.Assert(newToken, Not(Equals), token)
+
+	t411, err = NewT411ClientWithToken(s.server.URL, username, password, "invalid")
 	c.Assert(err, NotNil)
 	c.Assert(err.Error(), Equals, "invalid token format, must be of the form 12345:123:abcdefghijklmnopqr")
 }
+
+func (s *MySuite) TestTokenRefresh(c *C) {
+	t411, username, _ := s.createT411Client(c)
+	token, err := t411.GetToken()
+	c.Assert(err, IsNil)
+
+	// the request is replayed transparently with a new token
+	s.server.ExpireTokens()
+	checkUser(c, t411, username)
+	newToken, err := t411.GetToken()
+	c.Assert(err, IsNil)
+	c.Assert(newToken, Not(Equals), token)
+	c.Assert(s.server.Hits(t411test.AuthAPI), Equals, 2)
+	c.Assert(s.server.Hits(t411test.UsersProfileAPI), Equals, 2)
+
+	path, err := t411.DownloadTorrent(&Torrent{ID: "4831500"})
+	c.Assert(err, IsNil)
+	c.Assert(os.Remove(path), IsNil)
+	s.server.InjectError(t411test.TorrentsDownloadAPI, t411test.CodeTokenInvalid)
+	path, err = t411.DownloadTorrent(&Torrent{ID: "4831500"})
+	c.Assert(err, IsNil)
+	c.Assert(filepath.Base(path), Equals, "Vikings.S01E01.HDTV.x264.2HD.VOSTFR.torrent")
+	c.Assert(os.Remove(path), IsNil)
+
+	// the replayed request fails the same way
+	s.server.InjectError(t411test.TorrentsSearchAPI, t411test.CodeTokenExpired, t411test.CodeTokenExpired)
+	_, err = t411.SearchTorrentsByTerms("vikings", 1, 1, "", "", 0, 0)
+	c.Assert(err, FitsTypeOf, &TokenRefreshError{})
+	c.Assert(err.(*TokenRefreshError).Err, ErrorIs, ErrTokenExpired)
+
+	// retrieving a new token fails
+	s.server.ExpireTokens()
+	s.server.InjectError(t411test.AuthAPI, t411test.CodeWrongPassword)
+	_, err = t411.TermsTree()
+	c.Assert(err, FitsTypeOf, &TokenRefreshError{})
+	c.Assert(err.(*TokenRefreshError).Err, ErrorIs, ErrWrongPassword)
+}
+
+func (s *MySuite) TestAPIError(c *C) {
+	t411, _, _ := s.createT411Client(c)
+	_, err := t411.TorrentsDetails("1")
+	c.Assert(err, ErrorIs, ErrTorrentNotFound)
+	c.Assert(err, ErrorIs, err301TorrentNotFound)
+	c.Assert(err, Not(ErrorIs), ErrUserNotFound)
+	apiErr := &APIError{}
+	c.Assert(errors.As(err, &apiErr), Equals, true)
+	c.Assert(apiErr.Code, Equals, 301)
+	c.Assert(apiErr.Endpoint, Equals, "/torrents/details/")
+	c.Assert(apiErr.HTTPStatus, Equals, 200)
+
+	s.server.InjectError(t411test.CategoriesTreeAPI, t411test.CodeTokenInvalid, t411test.CodeTokenExpired)
+	_, err = t411.CategoriesTree()
+	c.Assert(err, ErrorIs, ErrTokenExpired)
+	c.Assert(err, Not(ErrorIs), ErrTokenInvalid)
+}
+
+func (s *MySuite) TestConcurrentRequests(c *C) {
+	t411, _, _ := s.createT411Client(c)
+	s.server.ExpireTokens()
+	const count = 20
+	errs := make(chan error, count)
+	wg := sync.WaitGroup{}
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			t411.SetMaxDelay(float64(i))
+			t411.KeepRatio(i%2 == 0)
+			_, err := t411.SearchTorrentsByTerms("vikings", 1, 1, "", "", 0, 0)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		c.Assert(err, IsNil)
+	}
+	// one authentication at creation, one single refresh afterwards
+	c.Assert(s.server.Hits(t411test.AuthAPI), Equals, 2)
+	c.Assert(s.server.Hits(t411test.TorrentsSearchAPI) > count, Equals, true)
+}
+
+// gatedTransport holds the authentication requests back until 'want'
+// other requests have been answered, once enabled.
+type gatedTransport struct {
+	mu      sync.Mutex
+	enabled bool
+	want    int
+	gate    chan struct{}
+}
+
+func (g *gatedTransport) enable(want int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.enabled = true
+	g.want = want
+	g.gate = make(chan struct{})
+}
+
+func (g *gatedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	g.mu.Lock()
+	enabled, gate := g.enabled, g.gate
+	g.mu.Unlock()
+	if enabled && strings.HasPrefix(req.URL.Path, "/auth") {
+		select {
+		case <-gate:
+		case <-time.After(5 * time.Second):
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if enabled {
+		g.mu.Lock()
+		g.want--
+		if g.want == 0 {
+			close(g.gate)
+		}
+		g.mu.Unlock()
+	}
+	return resp, err
+}
+
+func (s *MySuite) TestConcurrentFailingRefresh(c *C) {
+	transport := &gatedTransport{}
+	t411, err := New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithTransport(transport),
+	)
+	c.Assert(err, IsNil)
+	const count = 10
+	s.server.ExpireTokens()
+	s.server.InjectError(t411test.AuthAPI, t411test.CodeWrongPassword)
+	transport.enable(count)
+	errs := make(chan error, count)
+	wg := sync.WaitGroup{}
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := t411.UsersProfile("12345")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	// all the requests get the error of the single failed authentication
+	for err := range errs {
+		c.Assert(err, FitsTypeOf, &TokenRefreshError{})
+		c.Assert(err, ErrorIs, ErrWrongPassword)
+	}
+	c.Assert(s.server.Hits(t411test.AuthAPI), Equals, 2)
+}
+
+// slowAuthTransport delays the authentication requests by 'delay'.
+type slowAuthTransport struct {
+	delay time.Duration
+}
+
+func (s slowAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(req.URL.Path, "/auth") {
+		time.Sleep(s.delay)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (s *MySuite) TestRefreshNotBoundToFirstCaller(c *C) {
+	t411, err := New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithTransport(slowAuthTransport{delay: 300 * time.Millisecond}),
+	)
+	c.Assert(err, IsNil)
+	s.server.ExpireTokens()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	first := make(chan error)
+	go func() {
+		_, err := t411.UsersProfileContext(ctx, "12345")
+		first <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	// the second request waits for the refresh started by the first one
+	// and gets the new token even though the first one gave up
+	_, err = t411.UsersProfile("12345")
+	c.Assert(err, IsNil)
+	c.Assert(<-first, ErrorIs, context.DeadlineExceeded)
+	c.Assert(s.server.Hits(t411test.AuthAPI), Equals, 2)
+}
@@ -0,0 +1,220 @@
+package t411test
+
+import (
+	"fmt"
+)
+
+// User represents an account known by the fake t411 API.
+type User struct {
+	UID        string
+	Username   string
+	Password   string
+	Disabled   bool
+	Gender     string
+	Age        string
+	Avatar     string
+	Downloaded string
+	Uploaded   string
+}
+
+// Torrent represents a torrent served by the fake t411 API.
+// TermIDs are the term ids matched against the 'term[ID][]' search parameters,
+// Terms are the human readable terms returned by /torrents/details and
+// Data is the content of the .torrent file, generated from the name if empty.
+// ContentDisposition is the raw Content-Disposition header of the download
+// response, built from the name if empty.
+type Torrent struct {
+	ID             string
+	Name           string
+	Category       string
+	Categoryname   string
+	Categoryimage  string
+	Rewritename    string
+	Seeders        string
+	Leechers       string
+	Comments       string
+	IsVerified     string
+	Added          string
+	Size           string
+	TimesCompleted string
+	Owner          string
+	Username       string
+	Privacy        string
+	Description    string
+	Terms          map[string]string
+	TermIDs        []int
+	Data           []byte
+	// ContentDisposition set to "-" removes the header
+	ContentDisposition string
+}
+
+// Category represents a node of the categories tree.
+type Category struct {
+	ID   string              `json:"id,omitempty"`
+	Pid  string              `json:"pid,omitempty"`
+	Name string              `json:"name,omitempty"`
+	Cats map[string]Category `json:"cats,omitempty"`
+}
+
+// Term represents a term type of the terms tree.
+type Term struct {
+	Type  string            `json:"type"`
+	Mode  string            `json:"mode"`
+	Terms map[string]string `json:"terms"`
+}
+
+// API error codes known by the fake server.
+const (
+	CodeUserNotFound       = 101
+	CodeAccountDisabled    = 103
+	CodeWrongPassword      = 107
+	CodeTokenExpired       = 201
+	CodeTokenInvalid       = 202
+	CodeTorrentNotFound301 = 301
+	CodeTorrentNotFound    = 1301
+)
+
+var errorTexts = map[int]string{
+	CodeUserNotFound:       "User not found",
+	CodeAccountDisabled:    "Account is disabled",
+	CodeWrongPassword:      "Wrong password",
+	CodeTokenExpired:       "Token has expired. Please login",
+	CodeTokenInvalid:       "Invalid token",
+	CodeTorrentNotFound301: "Torrent not found",
+	CodeTorrentNotFound:    "Torrent not found",
+}
+
+func errorText(code int) string {
+	if text, ok := errorTexts[code]; ok {
+		return text
+	}
+	return fmt.Sprintf("Error %d", code)
+}
+
+// DefaultCategories returns a reduced copy of the t411 categories tree.
+// Like the real API, it contains one category without any id.
+func DefaultCategories() map[string]Category {
+	return map[string]Category{
+		"210": {
+			ID:   "210",
+			Pid:  "0",
+			Name: "Film/Vidéo",
+			Cats: map[string]Category{
+				"402": {ID: "402", Pid: "210", Name: "Vidéo-clips"},
+				"433": {ID: "433", Pid: "210", Name: "Série TV"},
+				"455": {ID: "455", Pid: "210", Name: "Animation"},
+				"631": {ID: "631", Pid: "210", Name: "Film"},
+				"633": {ID: "633", Pid: "210", Name: "Concert"},
+				"634": {ID: "634", Pid: "210", Name: "Documentaire"},
+				"635": {ID: "635", Pid: "210", Name: "Spectacle"},
+				"636": {ID: "636", Pid: "210", Name: "Sport"},
+				"637": {ID: "637", Pid: "210", Name: "Animation Série"},
+				"639": {ID: "639", Pid: "210", Name: "Emission TV"},
+			},
+		},
+		"395": {
+			ID:   "395",
+			Pid:  "0",
+			Name: "Audio",
+			Cats: map[string]Category{
+				"400": {ID: "400", Pid: "395", Name: "Karaoke"},
+				"403": {ID: "403", Pid: "395", Name: "Samples"},
+				"623": {ID: "623", Pid: "395", Name: "Musique"},
+				"642": {ID: "642", Pid: "395", Name: "Podcast Radio"},
+			},
+		},
+		"": {},
+	}
+}
+
+// DefaultTerms returns the terms tree of the 'Série TV' category (433)
+// with the season, episode, language and quality term types, using the
+// same ids as the real API.
+func DefaultTerms() map[string]map[string]Term {
+	seasons := map[string]string{"998": "Série intégrale"}
+	for i := 0; i < 30; i++ {
+		seasons[fmt.Sprint(968+i)] = fmt.Sprintf("Saison %02d", i+1)
+	}
+	// episode ids are not contiguous: 945 is skipped and
+	// episodes 16 and 17 are swapped.
+	episodes := map[string]string{}
+	start := 936
+	for i := 0; i < 31; i++ {
+		if i == 9 {
+			start++
+		}
+		episodes[fmt.Sprint(start+i)] = fmt.Sprintf("Episode %02d", i)
+		if i != 30 {
+			episodes[fmt.Sprint(1088+i)] = fmt.Sprintf("Episode %02d", 31+i)
+		}
+	}
+	episodes["936"] = "Saison complète"
+	episodes["953"], episodes["954"] = episodes["954"], episodes["953"]
+	return map[string]map[string]Term{
+		"433": {
+			"45": {
+				Type:  "SérieTV - Saison",
+				Mode:  "single",
+				Terms: seasons,
+			},
+			"46": {
+				Type:  "SérieTV - Episode",
+				Mode:  "single",
+				Terms: episodes,
+			},
+			"51": {
+				Type: "Vidéo - Langue",
+				Mode: "multi",
+				Terms: map[string]string{
+					"1209": "Anglais",
+					"1210": "Français (VFF/Truefrench)",
+					"1211": "Muet",
+					"1212": "Multi (Français inclus)",
+					"1213": "Multi (Québécois inclus)",
+					"1214": "Québécois (VFQ/French)",
+					"1215": "VFSTFR",
+					"1216": "VOSTFR",
+					"1217": "Voasta",
+				},
+			},
+			"7": {
+				Type: "Vidéo - Qualité",
+				Mode: "single",
+				Terms: map[string]string{
+					"8":    "BDrip/BRrip [Rip SD (non HD) depuis Bluray ou HDrip",
+					"10":   "DVDrip [Rip depuis DVD-R]",
+					"11":   "TVrip [Rip SD (non HD) depuis Source Tv HD/SD]",
+					"12":   "TVripHD 720 [Rip HD depuis Source Tv HD]",
+					"13":   "DVD-R 5 [DVD < 4.37GB]",
+					"14":   "DVD-R 9 [DVD > 4.37GB]",
+					"15":   "HDrip 720 [Rip HD depuis Bluray]",
+					"16":   "HDrip 1080 [Rip HD depuis Bluray]",
+					"17":   "Bluray [Full]",
+					"18":   "VCD/SVCD/VHSrip",
+					"19":   "WEBrip",
+					"1162": "TVripHD 1080 [Rip HD depuis Source Tv HD]",
+					"1171": "Bluray 4K [Full ou Remux]",
+					"1174": "Web-Dl 1080",
+					"1175": "Web-Dl 720",
+					"1182": "Web-Dl 4K",
+					"1219": "HDrip 4k [Rip HD 4k depuis source 4k]",
+					"1220": "Bluray [Remux]",
+					"1233": "Web-Dl",
+					"1235": "TvripHD 4k [Rip HD 4k depuis Source Tv 4k]",
+				},
+			},
+		},
+	}
+}
+
+// TorrentFile builds a minimal single file .torrent content for 'name', the
+// one served for torrents without Data.
+func TorrentFile(name string) []byte {
+	name += ".mkv"
+	pieces := make([]byte, 20)
+	copy(pieces, name)
+	return []byte(fmt.Sprintf("d8:announce%d:%s4:infod6:lengthi%de4:name%d:%s12:piece lengthi%de6:pieces%d:%see",
+		len(announceURL), announceURL, 1024, len(name), name, 16384, len(pieces), pieces))
+}
+
+const announceURL = "http://tracker.t411.test/announce"
@@ -0,0 +1,516 @@
+// Package t411test provides an in-process fake of the t411 API
+// so that t411client can be used and tested without network access.
+//
+// The server mimics the behavior of the real API, quirks included:
+// errors are returned with a 200 status code and some numeric fields
+// of the search response are not always encoded as strings.
+package t411test
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoints served by the fake server. They are the keys used
+// by InjectError and Hits.
+const (
+	AuthAPI             = "/auth"
+	UsersProfileAPI     = "/users/profile"
+	TorrentsSearchAPI   = "/torrents/search"
+	TorrentsDetailsAPI  = "/torrents/details"
+	TorrentsDownloadAPI = "/torrents/download"
+	CategoriesTreeAPI   = "/categories/tree"
+	TermsTreeAPI        = "/terms/tree"
+)
+
+var (
+	endpoints = []string{
+		AuthAPI,
+		UsersProfileAPI,
+		TorrentsSearchAPI,
+		TorrentsDetailsAPI,
+		TorrentsDownloadAPI,
+		CategoriesTreeAPI,
+		TermsTreeAPI,
+	}
+	termParam = regexp.MustCompile(`^term\[([0-9]+)\]\[\]$`)
+)
+
+// Server is a fake t411 API listening on a local address.
+// It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+	mu         sync.Mutex
+	users      map[string]*User
+	torrents   []*Torrent
+	categories map[string]Category
+	terms      map[string]map[string]Term
+	modified   time.Time
+	tokens     map[string]string
+	expired    map[string]bool
+	injected   map[string][]int
+	throttled  map[string][]throttle
+	junk       []interface{}
+	hits       map[string]int
+	issued     int
+}
+
+// NewServer starts and returns a new fake t411 API seeded with the
+// default categories and terms trees but no users nor torrents.
+// The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		users:      map[string]*User{},
+		categories: DefaultCategories(),
+		terms:      DefaultTerms(),
+		modified:   time.Now().UTC().Truncate(time.Second),
+		tokens:     map[string]string{},
+		expired:    map[string]bool{},
+		injected:   map[string][]int{},
+		throttled:  map[string][]throttle{},
+		hits:       map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// AddUser adds or replaces a user. A missing UID is generated.
+func (s *Server) AddUser(user User) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(user.UID) == 0 {
+		user.UID = strconv.Itoa(10000 + len(s.users))
+	}
+	s.users[user.Username] = &user
+	return &user
+}
+
+// AddTorrent adds torrents to the ones returned by the search,
+// details and download endpoints.
+func (s *Server) AddTorrent(torrents ...Torrent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range torrents {
+		torrent := torrents[i]
+		if len(torrent.Data) == 0 {
+			torrent.Data = TorrentFile(torrent.Name)
+		}
+		s.torrents = append(s.torrents, &torrent)
+	}
+}
+
+// RemoveTorrent removes the torrents with the given ids.
+func (s *Server) RemoveTorrent(ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		for i, torrent := range s.torrents {
+			if torrent.ID == id {
+				s.torrents = append(s.torrents[:i], s.torrents[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// SetCategories replaces the categories tree.
+func (s *Server) SetCategories(categories map[string]Category) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.categories = categories
+	s.touch()
+}
+
+// SetTerms replaces the terms tree.
+func (s *Server) SetTerms(terms map[string]map[string]Term) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.terms = terms
+	s.touch()
+}
+
+// touch updates the last modification time of the trees, making sure
+// it changes even if they are replaced twice in the same second.
+func (s *Server) touch() {
+	modified := time.Now().UTC().Truncate(time.Second)
+	if !modified.After(s.modified) {
+		modified = s.modified.Add(time.Second)
+	}
+	s.modified = modified
+}
+
+// InjectError makes the next requests to 'endpoint' fail with the given
+// API error codes, one code per request, in order.
+func (s *Server) InjectError(endpoint string, codes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.injected[endpoint] = append(s.injected[endpoint], codes...)
+}
+
+// throttle represents an injected throttling response.
+type throttle struct {
+	status     int
+	retryAfter string
+}
+
+// InjectThrottle makes the next request to 'endpoint' fail with the http
+// status code 'status', typically 429 or 503, and the Retry-After header
+// 'retryAfter' if not empty. Several calls queue several failures, in order.
+func (s *Server) InjectThrottle(endpoint string, status int, retryAfter string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.throttled[endpoint] = append(s.throttled[endpoint], throttle{status, retryAfter})
+}
+
+// InjectJunkEntries makes the search endpoint return the given entries in the
+// torrents list, like the integers the real API inserts sometimes.
+// Entry i is inserted before the torrent i, the remaining ones at the end.
+func (s *Server) InjectJunkEntries(entries ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.junk = append(s.junk, entries...)
+}
+
+// ExpireTokens makes every token issued so far expired.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token := range s.tokens {
+		s.expired[token] = true
+	}
+}
+
+// Hits returns the number of requests received by 'endpoint'.
+func (s *Server) Hits(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[endpoint]
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+// writeError writes an API error the way t411 does, with a 200 status code.
+func writeError(w http.ResponseWriter, code int) {
+	writeJSON(w, map[string]interface{}{
+		"error": errorText(code),
+		"code":  code,
+	})
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint := ""
+	for _, v := range endpoints {
+		if r.URL.Path == v || strings.HasPrefix(r.URL.Path, v+"/") {
+			endpoint = v
+			break
+		}
+	}
+	if len(endpoint) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	arg := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, endpoint), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hits[endpoint]++
+	if throttles := s.throttled[endpoint]; len(throttles) != 0 {
+		s.throttled[endpoint] = throttles[1:]
+		if len(throttles[0].retryAfter) != 0 {
+			w.Header().Set("Retry-After", throttles[0].retryAfter)
+		}
+		http.Error(w, http.StatusText(throttles[0].status), throttles[0].status)
+		return
+	}
+	if codes := s.injected[endpoint]; len(codes) != 0 {
+		s.injected[endpoint] = codes[1:]
+		writeError(w, codes[0])
+		return
+	}
+	if endpoint == AuthAPI {
+		s.auth(w, r)
+		return
+	}
+	token := r.Header.Get("Authorization")
+	if _, ok := s.tokens[token]; !ok {
+		writeError(w, CodeTokenInvalid)
+		return
+	}
+	if s.expired[token] {
+		writeError(w, CodeTokenExpired)
+		return
+	}
+	switch endpoint {
+	case UsersProfileAPI:
+		s.usersProfile(w, arg)
+	case TorrentsSearchAPI:
+		s.search(w, r, arg)
+	case TorrentsDetailsAPI:
+		s.details(w, arg)
+	case TorrentsDownloadAPI:
+		s.download(w, arg)
+	case CategoriesTreeAPI:
+		s.writeTree(w, r, s.categories)
+	case TermsTreeAPI:
+		s.writeTree(w, r, s.terms)
+	}
+}
+
+// writeTree writes a categories or terms tree with ETag and Last-Modified
+// headers, replying 304 Not Modified to matching conditional requests.
+func (s *Server) writeTree(w http.ResponseWriter, r *http.Request, tree interface{}) {
+	data, err := json.Marshal(tree)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	etag := fmt.Sprintf(`"%x"`, sha1.Sum(data))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", s.modified.Format(http.TimeFormat))
+	notModified := false
+	if match := r.Header.Get("If-None-Match"); len(match) != 0 {
+		notModified = match == etag
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		notModified = !s.modified.After(since)
+	}
+	if notModified {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (s *Server) auth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := s.users[r.PostFormValue("username")]
+	if !ok {
+		writeError(w, CodeUserNotFound)
+		return
+	}
+	if user.Disabled {
+		writeError(w, CodeAccountDisabled)
+		return
+	}
+	if user.Password != r.PostFormValue("password") {
+		writeError(w, CodeWrongPassword)
+		return
+	}
+	s.issued++
+	token := fmt.Sprintf("%s:%d:%x", user.UID, s.issued, sha1.Sum([]byte(fmt.Sprint(user.Username, s.issued))))
+	s.tokens[token] = user.UID
+	writeJSON(w, map[string]string{
+		"uid":   user.UID,
+		"token": token,
+	})
+}
+
+func (s *Server) usersProfile(w http.ResponseWriter, uid string) {
+	for _, user := range s.users {
+		if user.UID == uid {
+			writeJSON(w, map[string]string{
+				"username":   user.Username,
+				"gender":     user.Gender,
+				"age":        user.Age,
+				"avatar":     user.Avatar,
+				"downloaded": user.Downloaded,
+				"uploaded":   user.Uploaded,
+			})
+			return
+		}
+	}
+	writeError(w, CodeUserNotFound)
+}
+
+func (s *Server) findTorrent(id string) *Torrent {
+	for _, torrent := range s.torrents {
+		if torrent.ID == id {
+			return torrent
+		}
+	}
+	return nil
+}
+
+func matchQuery(torrent *Torrent, query string) bool {
+	name := strings.ToLower(torrent.Name)
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(name, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTerms checks that the torrent has at least one
+// of the requested terms for every requested term type.
+func matchTerms(torrent *Torrent, terms map[string][]string) bool {
+	for _, values := range terms {
+		found := false
+		for _, value := range values {
+			for _, ID := range torrent.TermIDs {
+				if strconv.Itoa(ID) == value {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchCategory checks that the torrent is in one of the
+// requested categories, if any.
+func matchCategory(torrent *Torrent, categories []string) bool {
+	for _, category := range categories {
+		if torrent.Category == category {
+			return true
+		}
+	}
+	return len(categories) == 0
+}
+
+func torrentJSON(torrent *Torrent) map[string]string {
+	return map[string]string{
+		"id":              torrent.ID,
+		"name":            torrent.Name,
+		"category":        torrent.Category,
+		"rewritename":     torrent.Rewritename,
+		"seeders":         torrent.Seeders,
+		"leechers":        torrent.Leechers,
+		"comments":        torrent.Comments,
+		"isVerified":      torrent.IsVerified,
+		"added":           torrent.Added,
+		"size":            torrent.Size,
+		"times_completed": torrent.TimesCompleted,
+		"owner":           torrent.Owner,
+		"categoryname":    torrent.Categoryname,
+		"categoryimage":   torrent.Categoryimage,
+		"username":        torrent.Username,
+		"privacy":         torrent.Privacy,
+	}
+}
+
+// search answers like the real API: offset and limit are echoed as strings
+// when given and as numbers otherwise, and a total of 0 is a number.
+func (s *Server) search(w http.ResponseWriter, r *http.Request, query string) {
+	params := r.URL.Query()
+	terms := map[string][]string{}
+	for key, values := range params {
+		if m := termParam.FindStringSubmatch(key); m != nil {
+			terms[m[1]] = values
+		}
+	}
+	matching := []map[string]string{}
+	for _, torrent := range s.torrents {
+		if matchQuery(torrent, query) && matchTerms(torrent, terms) && matchCategory(torrent, params["cid"]) {
+			matching = append(matching, torrentJSON(torrent))
+		}
+	}
+	response := map[string]interface{}{
+		"query":  query,
+		"offset": 0,
+		"limit":  10,
+		"total":  0,
+	}
+	offset, limit := 0, 10
+	if v := params.Get("offset"); len(v) != 0 {
+		offset, _ = strconv.Atoi(v)
+		response["offset"] = v
+	}
+	if v := params.Get("limit"); len(v) != 0 {
+		limit, _ = strconv.Atoi(v)
+		response["limit"] = v
+	}
+	if len(matching) != 0 {
+		response["total"] = strconv.Itoa(len(matching))
+	}
+	// the API ignores negative values
+	if offset < 0 {
+		offset = 0
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	if offset > len(matching) {
+		offset = len(matching)
+	}
+	if offset+limit < len(matching) {
+		matching = matching[:offset+limit]
+	}
+	torrents := []interface{}{}
+	for i, torrent := range matching[offset:] {
+		if i < len(s.junk) {
+			torrents = append(torrents, s.junk[i])
+		}
+		torrents = append(torrents, torrent)
+	}
+	if len(matching[offset:]) < len(s.junk) {
+		torrents = append(torrents, s.junk[len(matching[offset:]):]...)
+	}
+	response["torrents"] = torrents
+	writeJSON(w, response)
+}
+
+func (s *Server) details(w http.ResponseWriter, id string) {
+	torrent := s.findTorrent(id)
+	if torrent == nil {
+		writeError(w, CodeTorrentNotFound301)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"id":            torrent.ID,
+		"name":          torrent.Name,
+		"category":      torrent.Category,
+		"categoryname":  torrent.Categoryname,
+		"categoryimage": torrent.Categoryimage,
+		"rewritename":   torrent.Rewritename,
+		"owner":         torrent.Owner,
+		"username":      torrent.Username,
+		"privacy":       torrent.Privacy,
+		"description":   torrent.Description,
+		"terms":         torrent.Terms,
+	})
+}
+
+func (s *Server) download(w http.ResponseWriter, id string) {
+	torrent := s.findTorrent(id)
+	if torrent == nil {
+		writeError(w, CodeTorrentNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-bittorrent")
+	switch torrent.ContentDisposition {
+	case "":
+		// like t411, quote the name, falling back to the
+		// RFC 5987 encoding for names that cannot be quoted
+		filename := torrent.Name + ".torrent"
+		header := fmt.Sprintf("attachment; filename=%q", filename)
+		if strconv.Quote(filename) != `"`+filename+`"` {
+			header = mime.FormatMediaType("attachment", map[string]string{
+				"filename": filename,
+			})
+		}
+		w.Header().Set("Content-Disposition", header)
+	case "-":
+	default:
+		w.Header().Set("Content-Disposition", torrent.ContentDisposition)
+	}
+	w.Write(torrent.Data)
+}
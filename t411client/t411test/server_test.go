@@ -0,0 +1,109 @@
+package t411test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type MySuite struct {
+	server *Server
+}
+
+var _ = Suite(&MySuite{})
+
+func (s *MySuite) SetUpTest(c *C) {
+	s.server = NewServer()
+	s.server.AddUser(User{UID: "1", Username: "user", Password: "pass"})
+	s.server.AddTorrent(Torrent{ID: "10", Name: "Vikings.S01E01", TermIDs: []int{968, 937}})
+}
+
+func (s *MySuite) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *MySuite) get(c *C, path, token string) map[string]interface{} {
+	req, err := http.NewRequest("GET", s.server.URL+path, nil)
+	c.Assert(err, IsNil)
+	req.Header.Set("Authorization", token)
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, Equals, http.StatusOK)
+	data := map[string]interface{}{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(&data), IsNil)
+	return data
+}
+
+func (s *MySuite) auth(c *C, username, password string) map[string]interface{} {
+	resp, err := http.PostForm(s.server.URL+AuthAPI, url.Values{
+		"username": {username},
+		"password": {password},
+	})
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	data := map[string]interface{}{}
+	c.Assert(json.NewDecoder(resp.Body).Decode(&data), IsNil)
+	return data
+}
+
+func (s *MySuite) TestAuth(c *C) {
+	data := s.auth(c, "user", "wrong")
+	c.Assert(data["code"], Equals, float64(CodeWrongPassword))
+	data = s.auth(c, "unknown", "pass")
+	c.Assert(data["code"], Equals, float64(CodeUserNotFound))
+	data = s.auth(c, "user", "pass")
+	c.Assert(data["uid"], Equals, "1")
+	c.Assert(data["token"], Matches, "1:1:[0-9a-f]+")
+	c.Assert(s.server.Hits(AuthAPI), Equals, 3)
+
+	token := data["token"].(string)
+	c.Assert(s.get(c, "/users/profile/1", token)["username"], Equals, "user")
+	c.Assert(s.get(c, "/users/profile/1", "1:2:abc")["code"], Equals, float64(CodeTokenInvalid))
+	s.server.ExpireTokens()
+	c.Assert(s.get(c, "/users/profile/1", token)["code"], Equals, float64(CodeTokenExpired))
+}
+
+func (s *MySuite) TestSearch(c *C) {
+	token := s.auth(c, "user", "pass")["token"].(string)
+	data := s.get(c, "/torrents/search/vikings?term%5B45%5D%5B%5D=968", token)
+	c.Assert(data["offset"], Equals, float64(0))
+	c.Assert(data["limit"], Equals, float64(10))
+	c.Assert(data["total"], Equals, "1")
+	c.Assert(data["torrents"], HasLen, 1)
+
+	data = s.get(c, "/torrents/search/vikings?term%5B45%5D%5B%5D=969&offset=0&limit=5", token)
+	c.Assert(data["offset"], Equals, "0")
+	c.Assert(data["limit"], Equals, "5")
+	c.Assert(data["total"], Equals, float64(0))
+	c.Assert(data["torrents"], HasLen, 0)
+
+	// negative values are ignored instead of crashing the handler
+	data = s.get(c, "/torrents/search/vikings?offset=-5&limit=-1", token)
+	c.Assert(data["torrents"], HasLen, 0)
+	data = s.get(c, "/torrents/search/vikings?offset=-5&limit=10", token)
+	c.Assert(data["torrents"], HasLen, 1)
+
+	s.server.InjectError(TorrentsSearchAPI, CodeTokenExpired)
+	c.Assert(s.get(c, "/torrents/search/vikings", token)["code"], Equals, float64(CodeTokenExpired))
+	c.Assert(s.get(c, "/torrents/search/vikings", token)["total"], Equals, "1")
+}
+
+func (s *MySuite) TestDownload(c *C) {
+	token := s.auth(c, "user", "pass")["token"].(string)
+	c.Assert(s.get(c, "/torrents/download/11", token)["code"], Equals, float64(CodeTorrentNotFound))
+	c.Assert(s.get(c, "/torrents/details/11", token)["code"], Equals, float64(CodeTorrentNotFound301))
+
+	req, err := http.NewRequest("GET", s.server.URL+"/torrents/download/10", nil)
+	c.Assert(err, IsNil)
+	req.Header.Set("Authorization", token)
+	resp, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.Header.Get("Content-Disposition"), Equals, `attachment; filename="Vikings.S01E01.torrent"`)
+}
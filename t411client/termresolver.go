@@ -0,0 +1,372 @@
+package t411client
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TermMappings represents the term ids used to filter searches
+// by season, episode, language and quality.
+type TermMappings struct {
+	SeasonTypeID   int
+	EpisodeTypeID  int
+	LanguageTypeID int
+	QualityTypeID  int
+	// Seasons maps season numbers to term ids, 0 being the complete series.
+	Seasons map[int]int
+	// Episodes maps episode numbers to term ids, 0 being the complete season.
+	Episodes map[int]int
+	// Languages maps the lowercased language labels and the keys
+	// of the LanguageMap variable to term ids.
+	Languages map[string]int
+	// Qualities maps the quality labels, that is the keys
+	// of the QualityMap variable, to term ids.
+	Qualities map[string]int
+}
+
+// builtinTerms are the hard-coded term mappings, used when
+// the terms tree is not resolved or lacks some term types.
+var builtinTerms *TermMappings
+
+func newBuiltinTermMappings() *TermMappings {
+	m := &TermMappings{
+		SeasonTypeID:   catSeasonID,
+		EpisodeTypeID:  catEpisodeID,
+		LanguageTypeID: catLanguageID,
+		QualityTypeID:  catQualityID,
+		Seasons:        map[int]int{},
+		Episodes:       map[int]int{},
+		Languages:      map[string]int{},
+		Qualities:      map[string]int{},
+	}
+	for k, v := range seasonNbrID {
+		m.Seasons[k] = v
+	}
+	for k, v := range episodeNbrID {
+		m.Episodes[k] = v
+	}
+	for k, v := range LanguageMap {
+		m.Languages[k] = v
+	}
+	for k, v := range QualityMap {
+		m.Qualities[k] = v
+	}
+	return m
+}
+
+var (
+	seasonLabel  = regexp.MustCompile(`(?i)^saison\s+0*(\d+)$`)
+	episodeLabel = regexp.MustCompile(`(?i)^[ée]pisode\s+0*(\d+)$`)
+	// languageAliases maps the prefixes of the lowercased language labels
+	// to the keys of the LanguageMap variable.
+	languageAliases = []struct {
+		prefix string
+		key    string
+	}{
+		{"anglais", "english"},
+		{"français", "french"},
+		{"muet", "mute"},
+		{"multi (français", "multi-fr"},
+		{"multi (québécois", "multi-qb"},
+		{"québécois", "quebecker "},
+	}
+)
+
+// ParseTermMappings builds term mappings by parsing the labels of a terms tree,
+// the 'Série TV' category (433) being looked at first. When several term types
+// match, the built-in one wins, then the one with the lowest id.
+// The term types missing from the tree are taken from the built-in mappings.
+func ParseTermMappings(tree *TermsTree) *TermMappings {
+	m := &TermMappings{}
+	builtinTypeIDs := []string{
+		strconv.Itoa(builtinTerms.SeasonTypeID),
+		strconv.Itoa(builtinTerms.EpisodeTypeID),
+		strconv.Itoa(builtinTerms.LanguageTypeID),
+		strconv.Itoa(builtinTerms.QualityTypeID),
+	}
+	categoryIDs := make([]string, 0, len(tree.ByCategoryID))
+	for ID := range tree.ByCategoryID {
+		categoryIDs = append(categoryIDs, ID)
+	}
+	for _, categoryID := range sortedIDs(categoryIDs, "433") {
+		types := tree.ByCategoryID[categoryID]
+		typeIDs := make([]string, 0, len(types))
+		for ID := range types {
+			typeIDs = append(typeIDs, ID)
+		}
+		for _, typeID := range sortedIDs(typeIDs, builtinTypeIDs...) {
+			term := types[typeID]
+			ID, err := strconv.Atoi(typeID)
+			if err != nil {
+				continue
+			}
+			label := strings.ToLower(term.Type)
+			switch {
+			case m.Seasons == nil && strings.Contains(label, "saison"):
+				m.SeasonTypeID, m.Seasons = ID, parseNumberTerms(term.Terms, seasonLabel, "série intégrale")
+			case m.Episodes == nil && (strings.Contains(label, "episode") || strings.Contains(label, "épisode")):
+				m.EpisodeTypeID, m.Episodes = ID, parseNumberTerms(term.Terms, episodeLabel, "saison complète")
+			case m.Languages == nil && strings.Contains(label, "langue"):
+				m.LanguageTypeID, m.Languages = ID, parseLanguageTerms(term.Terms)
+			case m.Qualities == nil && strings.Contains(label, "qualité"):
+				m.QualityTypeID, m.Qualities = ID, parseQualityTerms(term.Terms)
+			}
+		}
+	}
+	if len(m.Seasons) == 0 {
+		m.SeasonTypeID, m.Seasons = builtinTerms.SeasonTypeID, builtinTerms.Seasons
+	}
+	if len(m.Episodes) == 0 {
+		m.EpisodeTypeID, m.Episodes = builtinTerms.EpisodeTypeID, builtinTerms.Episodes
+	}
+	if len(m.Languages) == 0 {
+		m.LanguageTypeID, m.Languages = builtinTerms.LanguageTypeID, builtinTerms.Languages
+	}
+	if len(m.Qualities) == 0 {
+		m.QualityTypeID, m.Qualities = builtinTerms.QualityTypeID, builtinTerms.Qualities
+	}
+	return m
+}
+
+// sortedIDs sorts the ids, the 'first' ones first and the others by
+// numeric value, so that the mappings do not depend on map iteration order.
+func sortedIDs(IDs []string, first ...string) []string {
+	rank := func(ID string) int {
+		for i, f := range first {
+			if ID == f {
+				return i
+			}
+		}
+		return len(first)
+	}
+	sort.Slice(IDs, func(i, j int) bool {
+		if rank(IDs[i]) != rank(IDs[j]) {
+			return rank(IDs[i]) < rank(IDs[j])
+		}
+		a, _ := strconv.Atoi(IDs[i])
+		b, _ := strconv.Atoi(IDs[j])
+		if a != b {
+			return a < b
+		}
+		return IDs[i] < IDs[j]
+	})
+	return IDs
+}
+
+// termLabel is a term of the terms tree.
+type termLabel struct {
+	ID    int
+	label string
+}
+
+// sortedTerms returns the terms with a numeric id sorted by id, so that
+// the mappings do not depend on the iteration order of the map.
+func sortedTerms(terms map[string]string) []termLabel {
+	sorted := make([]termLabel, 0, len(terms))
+	for k, v := range terms {
+		ID, err := strconv.Atoi(k)
+		if err != nil {
+			continue
+		}
+		sorted = append(sorted, termLabel{ID: ID, label: strings.TrimSpace(v)})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
+
+// parseNumberTerms maps the numbers found in the labels to the term ids,
+// the label 'zero' being mapped to 0. The lowest id wins when several
+// labels give the same number.
+func parseNumberTerms(terms map[string]string, re *regexp.Regexp, zero string) map[int]int {
+	numbers := map[int]int{}
+	set := func(number, ID int) {
+		if _, ok := numbers[number]; !ok {
+			numbers[number] = ID
+		}
+	}
+	for _, term := range sortedTerms(terms) {
+		if strings.EqualFold(term.label, zero) {
+			set(0, term.ID)
+			continue
+		}
+		match := re.FindStringSubmatch(term.label)
+		if match == nil {
+			continue
+		}
+		number, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		set(number, term.ID)
+	}
+	return numbers
+}
+
+// parseLanguageTerms maps the lowercase labels and their aliases to the term ids.
+// Labels take precedence over aliases and the lowest id wins otherwise.
+func parseLanguageTerms(terms map[string]string) map[string]int {
+	languages := map[string]int{}
+	sorted := sortedTerms(terms)
+	for _, term := range sorted {
+		label := strings.ToLower(term.label)
+		if _, ok := languages[label]; !ok {
+			languages[label] = term.ID
+		}
+	}
+	for _, term := range sorted {
+		label := strings.ToLower(term.label)
+		for _, alias := range languageAliases {
+			if strings.HasPrefix(label, alias.prefix) {
+				if _, ok := languages[alias.key]; !ok {
+					languages[alias.key] = term.ID
+				}
+				break
+			}
+		}
+	}
+	return languages
+}
+
+// parseQualityTerms maps the labels to the term ids, the lowest id winning.
+func parseQualityTerms(terms map[string]string) map[string]int {
+	qualities := map[string]int{}
+	for _, term := range sortedTerms(terms) {
+		if _, ok := qualities[term.label]; !ok {
+			qualities[term.label] = term.ID
+		}
+	}
+	return qualities
+}
+
+// termsRetryDelay is the delay before fetching again a terms
+// tree that could not be fetched, unless the ttl is shorter.
+const termsRetryDelay = time.Minute
+
+// TermResolver resolves the term mappings from the terms tree of the API.
+// The mappings are cached for a given duration and the built-in ones
+// are used as long as the terms tree cannot be fetched.
+type TermResolver struct {
+	client   *T411
+	ttl      time.Duration
+	mu       sync.Mutex
+	mappings *TermMappings
+	expires  time.Time
+	// fetching is closed once the terms tree being fetched is parsed,
+	// nil if it is not being fetched.
+	fetching chan struct{}
+}
+
+// NewTermResolver creates a resolver fetching the terms tree with 'client'
+// and caching the resulting mappings for 'ttl'.
+func NewTermResolver(client *T411, ttl time.Duration) *TermResolver {
+	return &TermResolver{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+// Mappings returns the cached term mappings, fetching the terms tree
+// again once they have expired.
+func (r *TermResolver) Mappings() *TermMappings {
+	return r.MappingsContext(context.Background())
+}
+
+// MappingsContext does the same as Mappings using the
+// provided context for the underlying http requests.
+// If the terms tree cannot be fetched, the previous mappings or the built-in
+// ones are returned and the terms tree is fetched again after a short delay,
+// nothing being cached if 'ctx' is done.
+// While the terms tree is being fetched, the expired mappings are returned
+// to the other callers, which only wait if there are none yet.
+func (r *TermResolver) MappingsContext(ctx context.Context) *TermMappings {
+	for {
+		r.mu.Lock()
+		if r.mappings != nil && time.Now().Before(r.expires) {
+			defer r.mu.Unlock()
+			return r.mappings
+		}
+		if r.fetching == nil {
+			break
+		}
+		fetching, mappings := r.fetching, r.mappings
+		r.mu.Unlock()
+		if mappings != nil {
+			return mappings
+		}
+		select {
+		case <-fetching:
+			// the fetch may have been given up by its caller, it is retried
+		case <-ctx.Done():
+			return builtinTerms
+		}
+	}
+	fetching := make(chan struct{})
+	r.fetching = fetching
+	r.mu.Unlock()
+
+	tree, err := r.client.TermsTreeContext(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer close(fetching)
+	r.fetching = nil
+	if err != nil {
+		r.client.logger.Printf("Failed to resolve terms, using %s ones: %s", r.fallbackName(), err)
+		if ctx.Err() != nil {
+			return r.fallback()
+		}
+		r.mappings = r.fallback()
+		r.expires = time.Now().Add(r.retryDelay())
+		return r.mappings
+	}
+	r.mappings = ParseTermMappings(tree)
+	r.expires = time.Now().Add(r.ttl)
+	return r.mappings
+}
+
+// fallback returns the cached mappings or the built-in ones if there are none.
+func (r *TermResolver) fallback() *TermMappings {
+	if r.mappings == nil {
+		return builtinTerms
+	}
+	return r.mappings
+}
+
+// retryDelay returns the delay before fetching again a
+// terms tree that could not be fetched, 'ttl' at most.
+func (r *TermResolver) retryDelay() time.Duration {
+	if r.ttl < termsRetryDelay {
+		return r.ttl
+	}
+	return termsRetryDelay
+}
+
+func (r *TermResolver) fallbackName() string {
+	if r.mappings == nil || r.mappings == builtinTerms {
+		return "built-in"
+	}
+	return "previous"
+}
+
+// Invalidate drops the cached mappings so that the next
+// call to Mappings fetches the terms tree again.
+func (r *TermResolver) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mappings = nil
+}
+
+// termMappings returns the term mappings resolved by the client
+// or the built-in ones if it has no term resolver.
+func (t *T411) termMappings(ctx context.Context) *TermMappings {
+	if t.terms == nil {
+		return builtinTerms
+	}
+	return t.terms.MappingsContext(ctx)
+}
@@ -0,0 +1,240 @@
+package t411client
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dns-gh/t411-client/t411client/t411test"
+	. "gopkg.in/check.v1"
+)
+
+// renumberedTerms returns a terms tree where the season and episode
+// term types and ids differ from the built-in ones.
+func renumberedTerms() map[string]map[string]t411test.Term {
+	return map[string]map[string]t411test.Term{
+		"433": {
+			"145": {
+				Type: "SérieTV - Saison",
+				Mode: "single",
+				Terms: map[string]string{
+					"2000": "Saison 01",
+					"2001": "Saison 02",
+					"2031": "Saison 32",
+					"2099": "Série intégrale",
+					"2100": "Hors saison",
+				},
+			},
+			"146": {
+				Type: "SérieTV - Episode",
+				Mode: "single",
+				Terms: map[string]string{
+					"3000": "Saison complète",
+					"3017": "Episode 16",
+					"3016": "Episode 17",
+				},
+			},
+		},
+	}
+}
+
+func (s *MySuite) TestParseTermMappings(c *C) {
+	t411, _, _ := s.createT411Client(c)
+	tree, err := t411.TermsTree()
+	c.Assert(err, IsNil)
+	mappings := ParseTermMappings(tree)
+	c.Assert(mappings.SeasonTypeID, Equals, catSeasonID)
+	c.Assert(mappings.EpisodeTypeID, Equals, catEpisodeID)
+	c.Assert(mappings.LanguageTypeID, Equals, catLanguageID)
+	c.Assert(mappings.QualityTypeID, Equals, catQualityID)
+	c.Assert(mappings.Seasons, DeepEquals, seasonNbrID)
+	c.Assert(mappings.Episodes, DeepEquals, episodeNbrID)
+	c.Assert(mappings.Qualities, DeepEquals, QualityMap)
+	for k, v := range LanguageMap {
+		c.Assert(mappings.Languages[k], Equals, v, Commentf("language %q", k))
+	}
+	c.Assert(mappings.Languages["anglais"], Equals, 1209)
+
+	s.server.SetTerms(renumberedTerms())
+	tree, err = t411.TermsTree()
+	c.Assert(err, IsNil)
+	mappings = ParseTermMappings(tree)
+	c.Assert(mappings.SeasonTypeID, Equals, 145)
+	c.Assert(mappings.Seasons, DeepEquals, map[int]int{0: 2099, 1: 2000, 2: 2001, 32: 2031})
+	c.Assert(mappings.EpisodeTypeID, Equals, 146)
+	c.Assert(mappings.Episodes, DeepEquals, map[int]int{0: 3000, 16: 3017, 17: 3016})
+	// missing term types fall back to the built-in ones
+	c.Assert(mappings.LanguageTypeID, Equals, catLanguageID)
+	c.Assert(mappings.Languages, DeepEquals, LanguageMap)
+	c.Assert(mappings.QualityTypeID, Equals, catQualityID)
+	c.Assert(mappings.Qualities, DeepEquals, QualityMap)
+}
+
+func (s *MySuite) TestTermResolver(c *C) {
+	s.server.SetTerms(renumberedTerms())
+	s.server.AddTorrent(t411test.Torrent{ID: "1", Name: "Renumbered.S32E17", TermIDs: []int{2031, 3016}})
+	t411, err := New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithTermResolver(time.Hour),
+	)
+	c.Assert(err, IsNil)
+
+	query := t411.NewSearchQuery("renumbered").Season(32).Episode(17)
+	c.Assert(query.Err(), IsNil)
+	c.Assert(query.Values().Encode(), Equals, "term%5B145%5D%5B%5D=2031&term%5B146%5D%5B%5D=3016")
+	torrents, err := t411.Search(query)
+	c.Assert(err, IsNil)
+	c.Assert(torrents.Torrents, HasLen, 1)
+	torrents, err = t411.SearchTorrentsByTerms("renumbered", 32, 17, "", "", 0, 0)
+	c.Assert(err, IsNil)
+	c.Assert(torrents.Torrents, HasLen, 1)
+	c.Assert(t411.NewSearchQuery("renumbered").Season(3).Err(), ErrorIs, ErrInvalidQuery)
+	// package level queries keep using the built-in mappings
+	c.Assert(NewSearchQuery("renumbered").Season(32).Err(), ErrorIs, ErrInvalidQuery)
+
+	// mappings are cached
+	c.Assert(s.server.Hits(t411test.TermsTreeAPI), Equals, 1)
+	t411.terms.Invalidate()
+	s.server.SetTerms(t411test.DefaultTerms())
+	c.Assert(t411.NewSearchQuery("vikings").Season(1).Values().Encode(), Equals, "term%5B45%5D%5B%5D=968")
+	c.Assert(s.server.Hits(t411test.TermsTreeAPI), Equals, 2)
+
+	// built-in mappings are used when the terms tree cannot be fetched
+	t411, err = New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithTermResolver(time.Hour),
+	)
+	c.Assert(err, IsNil)
+	s.server.InjectError(t411test.TermsTreeAPI, 500)
+	c.Assert(t411.NewSearchQuery("vikings").Season(1).Values().Encode(), Equals, "term%5B45%5D%5B%5D=968")
+	c.Assert(t411.terms.Mappings(), Equals, builtinTerms)
+	c.Assert(s.server.Hits(t411test.TermsTreeAPI), Equals, 3)
+
+	// previous mappings are kept when the terms tree cannot be fetched anymore
+	resolver := NewTermResolver(t411, -time.Second)
+	s.server.SetTerms(renumberedTerms())
+	mappings := resolver.Mappings()
+	c.Assert(mappings.SeasonTypeID, Equals, 145)
+	s.server.InjectError(t411test.TermsTreeAPI, 500)
+	c.Assert(resolver.Mappings(), Equals, mappings)
+	c.Assert(s.server.Hits(t411test.TermsTreeAPI), Equals, 5)
+	// and fetched again shortly after
+	c.Assert(NewTermResolver(t411, time.Hour).retryDelay(), Equals, termsRetryDelay)
+	c.Assert(NewTermResolver(t411, time.Second).retryDelay(), Equals, time.Second)
+}
+
+func (s *MySuite) TestTermResolverCancelled(c *C) {
+	s.server.SetTerms(renumberedTerms())
+	t411, err := New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithTermResolver(time.Hour),
+	)
+	c.Assert(err, IsNil)
+	// the built-in mappings are not cached for a request given up by its caller
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(t411.terms.MappingsContext(ctx), Equals, builtinTerms)
+	c.Assert(t411.terms.Mappings().SeasonTypeID, Equals, 145)
+}
+
+func (s *MySuite) TestParseTermsDeterministic(c *C) {
+	// labels mapping to the same key are resolved the same way on every run
+	for i := 0; i < 20; i++ {
+		languages := parseLanguageTerms(map[string]string{
+			"1212": "Français (VFQ)",
+			"1210": "Français (VFF)",
+			"1211": "français",
+			"1216": "Anglais",
+			"1215": "Anglais (VO)",
+		})
+		c.Assert(languages["french"], Equals, 1210)
+		c.Assert(languages["français"], Equals, 1211)
+		c.Assert(languages["english"], Equals, 1215)
+		seasons := parseNumberTerms(map[string]string{
+			"970": "Saison 02",
+			"969": "Saison 2",
+			"999": "Série intégrale",
+			"998": "Série intégrale",
+		}, seasonLabel, "série intégrale")
+		c.Assert(seasons, DeepEquals, map[int]int{0: 998, 2: 969})
+		qualities := parseQualityTerms(map[string]string{"12": "HDrip 720", "11": "HDrip 720 "})
+		c.Assert(qualities, DeepEquals, map[string]int{"HDrip 720": 11})
+
+		// so are term types matching the same kind of terms, the built-in one
+		// winning, then the one with the lowest id, the 'Série TV' category first
+		mappings := ParseTermMappings(&TermsTree{ByCategoryID: map[string]ByTermID{
+			"210": {
+				"9": {Type: "Vidéo - Langue", Terms: map[string]string{"1": "Anglais"}},
+			},
+			"433": {
+				"60": {Type: "Vidéo - Langue", Terms: map[string]string{"2": "Anglais"}},
+				"17": {Type: "Vidéo - Langue", Terms: map[string]string{"3": "Anglais"}},
+				"51": {Type: "Vidéo - Langue", Terms: map[string]string{"4": "Anglais"}},
+				"33": {Type: "SérieTV - Saison", Terms: map[string]string{"5": "Saison 01"}},
+				"32": {Type: "SérieTV - Saison", Terms: map[string]string{"6": "Saison 01"}},
+			},
+			"631": {
+				"8": {Type: "Vidéo - Qualité", Terms: map[string]string{"7": "HDrip 720"}},
+			},
+			"402": {
+				"9": {Type: "Vidéo - Qualité", Terms: map[string]string{"8": "HDrip 720"}},
+			},
+		}})
+		c.Assert(mappings.LanguageTypeID, Equals, catLanguageID)
+		c.Assert(mappings.Languages["english"], Equals, 4)
+		c.Assert(mappings.SeasonTypeID, Equals, 32)
+		c.Assert(mappings.Seasons[1], Equals, 6)
+		c.Assert(mappings.QualityTypeID, Equals, 9)
+		c.Assert(mappings.Qualities["HDrip 720"], Equals, 8)
+	}
+}
+
+// blockingTransport holds the terms tree requests back until 'release' is closed.
+type blockingTransport struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(req.URL.Path, t411test.TermsTreeAPI) {
+		b.started <- struct{}{}
+		<-b.release
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (s *MySuite) TestTermResolverServesExpiredMappingsWhileFetching(c *C) {
+	transport := &blockingTransport{
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	t411, err := New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithTransport(transport),
+	)
+	c.Assert(err, IsNil)
+	resolver := NewTermResolver(t411, -time.Second)
+	s.server.SetTerms(renumberedTerms())
+	close(transport.release)
+	mappings := resolver.Mappings()
+	c.Assert(mappings.SeasonTypeID, Equals, 145)
+	<-transport.started
+
+	// the expired mappings are returned while the terms tree is being fetched
+	transport.release = make(chan struct{})
+	s.server.SetTerms(t411test.DefaultTerms())
+	fetched := make(chan *TermMappings)
+	go func() {
+		fetched <- resolver.Mappings()
+	}()
+	<-transport.started
+	c.Assert(resolver.Mappings(), Equals, mappings)
+	close(transport.release)
+	c.Assert((<-fetched).SeasonTypeID, Equals, catSeasonID)
+	c.Assert(s.server.Hits(t411test.TermsTreeAPI), Equals, 2)
+}
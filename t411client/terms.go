@@ -1,6 +1,8 @@
 package t411client
 
 import (
+	"context"
+	"fmt"
 	"net/url"
 )
 
@@ -19,22 +21,23 @@ type TermsTree struct {
 	ByCategoryID map[string]ByTermID
 }
 
-// TermsTree gets the terms tree
+// TermsTree gets the terms tree.
+// It is served from the cache of the client, if any. See WithCache.
 func (t *T411) TermsTree() (*TermsTree, error) {
-	usedAPI := "/terms/tree"
-	u, err := url.Parse(t.baseURL + usedAPI)
-	if err != nil {
-		return nil, ErrURLParsing
-	}
+	return t.TermsTreeContext(context.Background())
+}
 
-	resp, err := t.do("GET", u, nil)
+// TermsTreeContext does the same as TermsTree using the
+// provided context for the underlying http requests.
+func (t *T411) TermsTreeContext(ctx context.Context) (*TermsTree, error) {
+	usedAPI := "/terms/tree"
+	u, err := url.Parse(t.getBaseURL() + usedAPI)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %s", ErrURLParsing, err)
 	}
-	defer resp.Body.Close()
 
 	termsTree := &TermsTree{}
-	err = t.decode(&termsTree.ByCategoryID, resp, usedAPI, u.RawQuery)
+	err = t.getCached(ctx, usedAPI, u, &termsTree.ByCategoryID)
 	if err != nil {
 		return nil, err
 	}
@@ -22,7 +22,7 @@ func checkTermsTree(c *C, termsTree map[string]ByTermID) {
 }
 
 func (s *MySuite) TestTermsTree(c *C) {
-	t411, _, _ := createT411Client(c)
+	t411, _, _ := s.createT411Client(c)
 	termsTree, err := t411.TermsTree()
 	c.Assert(err, IsNil)
 	c.Assert(termsTree.ByCategoryID, Not(HasLen), 0)
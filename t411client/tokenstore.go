@@ -0,0 +1,69 @@
+package t411client
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/dns-gh/t411-client/t411client/internal/atomicfile"
+)
+
+// TokenStore persists the token of a T411 client across sessions.
+// Load returns an empty token and no error if no token has been saved yet.
+type TokenStore interface {
+	Load() (string, error)
+	Save(token string) error
+}
+
+// MemoryTokenStore is a TokenStore keeping the token in memory.
+// It is safe for concurrent use.
+type MemoryTokenStore struct {
+	mu    sync.Mutex
+	token string
+}
+
+// Load implements the TokenStore interface.
+func (m *MemoryTokenStore) Load() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.token, nil
+}
+
+// Save implements the TokenStore interface.
+func (m *MemoryTokenStore) Save(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.token = token
+	return nil
+}
+
+// FileTokenStore is a TokenStore keeping the token in a file.
+type FileTokenStore struct {
+	path string
+}
+
+// NewFileTokenStore creates a TokenStore saving the token in the file at 'path'.
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{
+		path: path,
+	}
+}
+
+// Load implements the TokenStore interface.
+func (f *FileTokenStore) Load() (string, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Save implements the TokenStore interface. The file is replaced atomically
+// and is only readable by its owner since the token gives access to the account.
+func (f *FileTokenStore) Save(token string) error {
+	return atomicfile.Write(f.path, []byte(token), 0600)
+}
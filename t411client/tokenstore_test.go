@@ -0,0 +1,76 @@
+package t411client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dns-gh/t411-client/t411client/t411test"
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) TestFileTokenStore(c *C) {
+	path := filepath.Join(c.MkDir(), "token")
+	store := NewFileTokenStore(path)
+	token, err := store.Load()
+	c.Assert(err, IsNil)
+	c.Assert(token, HasLen, 0)
+
+	c.Assert(store.Save("12345:1:abcdef"), IsNil)
+	token, err = store.Load()
+	c.Assert(err, IsNil)
+	c.Assert(token, Equals, "12345:1:abcdef")
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Assert(info.Mode().Perm(), Equals, os.FileMode(0600))
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+}
+
+func (s *MySuite) TestNewWithTokenStore(c *C) {
+	store := &MemoryTokenStore{}
+	t411, err := New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithTokenStore(store),
+	)
+	c.Assert(err, IsNil)
+	token, err := t411.GetToken()
+	c.Assert(err, IsNil)
+	stored, err := store.Load()
+	c.Assert(err, IsNil)
+	c.Assert(stored, Equals, token)
+
+	// the stored token is reused
+	t411, err = New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithTokenStore(store),
+	)
+	c.Assert(err, IsNil)
+	c.Assert(s.server.Hits(t411test.AuthAPI), Equals, 1)
+
+	// refreshed tokens are saved
+	s.server.ExpireTokens()
+	checkUser(c, t411, testUsername)
+	c.Assert(s.server.Hits(t411test.AuthAPI), Equals, 2)
+	token, err = t411.GetToken()
+	c.Assert(err, IsNil)
+	stored, err = store.Load()
+	c.Assert(err, IsNil)
+	c.Assert(stored, Equals, token)
+
+	// an invalid stored token is replaced
+	c.Assert(store.Save("invalid"), IsNil)
+	_, err = New(
+		WithBaseURL(s.server.URL),
+		WithCredentials(testUsername, testPassword),
+		WithTokenStore(store),
+	)
+	c.Assert(err, IsNil)
+	stored, err = store.Load()
+	c.Assert(err, IsNil)
+	c.Assert(stored, Not(Equals), "invalid")
+	c.Assert(s.server.Hits(t411test.AuthAPI), Equals, 3)
+}
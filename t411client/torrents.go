@@ -1,12 +1,13 @@
 package t411client
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"math"
 	"net/url"
 	"os"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -14,21 +15,47 @@ import (
 )
 
 var (
-	errEOF = errors.New("no more torrents to find")
+	// ErrEOF is returned by SearchIterator.Next when all the torrents have been returned.
+	ErrEOF = errors.New("no more torrents to find")
 	// it seems like a bug in the t411 API where two identicals errors
 	// have different error codes. The one to remove would be the err301...
-	err301TorrentNotFound = &errAPI{
+	err301TorrentNotFound = &APIError{
 		Code: 301,
 		Text: "Torrent not found",
 	}
-	//ErrTorrentNotFound represents the 1301 error code 'torrent not found'.
-	ErrTorrentNotFound = &errAPI{
+	// ErrTorrentNotFound represents the 1301 error code 'torrent not found'.
+	// Using errors.Is, it also matches the 301 error code.
+	ErrTorrentNotFound = &APIError{
 		Code: 1301,
 		Text: "Torrent not found",
 	}
+	// ErrKeepRatio is returned when a download is refused because
+	// it would put the ratio below 1. See KeepRatio.
+	ErrKeepRatio = errors.New("cannot download to keep ratio > 1")
+	// ErrNotVerified is returned when a download is refused because
+	// the torrent is not verified. See OnlyVerified.
+	ErrNotVerified = errors.New("cannot download non-verified torrent")
 )
 
-// Torrent represents a torrent as return by the t411 API
+func isTorrentNotFound(code int) bool {
+	return code == err301TorrentNotFound.Code || code == ErrTorrentNotFound.Code
+}
+
+// TorrentValues represents the typed values of the numeric,
+// boolean and date fields of a torrent.
+type TorrentValues struct {
+	Seeders        int
+	Leechers       int
+	Comments       int
+	TimesCompleted int
+	// Size is the size of the torrent content in bytes.
+	Size       int64
+	IsVerified bool
+	Added      time.Time
+}
+
+// Torrent represents a torrent as return by the t411 API.
+// The string fields hold the raw values returned by the API.
 type Torrent struct {
 	ID             string `json:"id"`
 	Name           string `json:"name"`
@@ -46,6 +73,198 @@ type Torrent struct {
 	Categoryimage  string `json:"categoryimage"`
 	Username       string `json:"username"`
 	Privacy        string `json:"privacy"`
+	// Values holds the typed values of the raw fields. It is set when
+	// decoding the torrent from JSON or when calling ParseValues.
+	Values TorrentValues `json:"-"`
+	// InvalidFields are the JSON names of the raw fields that could not be
+	// decoded or parsed by ParseValues, their values being left to zero.
+	InvalidFields []string `json:"-"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. Every field can
+// be encoded as a JSON string, number or boolean. The fields that cannot be
+// decoded, like a list, or parsed into the typed values, like the '0000-00-00 00:00:00'
+// date, are listed in InvalidFields instead of failing the whole torrent.
+// It only fails if the data is not a JSON object or if the id cannot be decoded.
+func (t *Torrent) UnmarshalJSON(data []byte) error {
+	raw := map[string]json.RawMessage{}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	torrent := Torrent{}
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"id", &torrent.ID},
+		{"name", &torrent.Name},
+		{"category", &torrent.Category},
+		{"rewritename", &torrent.Rewritename},
+		{"seeders", &torrent.Seeders},
+		{"leechers", &torrent.Leechers},
+		{"comments", &torrent.Comments},
+		{"isVerified", &torrent.IsVerified},
+		{"added", &torrent.Added},
+		{"size", &torrent.Size},
+		{"times_completed", &torrent.TimesCompleted},
+		{"owner", &torrent.Owner},
+		{"categoryname", &torrent.Categoryname},
+		{"categoryimage", &torrent.Categoryimage},
+		{"username", &torrent.Username},
+		{"privacy", &torrent.Privacy},
+	}
+	undecoded := []string{}
+	for _, field := range fields {
+		data, ok := raw[field.name]
+		if !ok {
+			continue
+		}
+		value := rawString("")
+		err = json.Unmarshal(data, &value)
+		if err != nil {
+			// a torrent cannot be used without its id
+			if field.name == "id" {
+				return fmt.Errorf("invalid torrent id: %w", err)
+			}
+			undecoded = append(undecoded, field.name)
+			continue
+		}
+		*field.value = string(value)
+	}
+	// the invalid fields are recorded in the torrent
+	torrent.ParseValues()
+	if len(undecoded) != 0 {
+		torrent.InvalidFields = append(undecoded, torrent.InvalidFields...)
+	}
+	*t = torrent
+	return nil
+}
+
+func parseInt(name, value string) (int, error) {
+	if len(value) == 0 {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return v, nil
+}
+
+// parseSize parses a size in bytes, large sizes written
+// as floating point numbers being capped to math.MaxInt64.
+func parseSize(value string) (int64, error) {
+	if len(value) == 0 {
+		return 0, nil
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		return size, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	if f >= math.MaxInt64 {
+		return math.MaxInt64, nil
+	}
+	return int64(f), nil
+}
+
+// ParseValues parses the raw fields of the torrent into its typed Values.
+// Empty raw fields are parsed as zero values. The fields that cannot be parsed
+// are left to zero and listed in InvalidFields, the returned error describing them.
+func (t *Torrent) ParseValues() error {
+	values := TorrentValues{}
+	invalid := []string{}
+	errs := []error{}
+	check := func(name string, err error) {
+		if err != nil {
+			invalid = append(invalid, name)
+			errs = append(errs, err)
+		}
+	}
+	var err error
+	values.Seeders, err = parseInt("seeders", t.Seeders)
+	check("seeders", err)
+	values.Leechers, err = parseInt("leechers", t.Leechers)
+	check("leechers", err)
+	values.Comments, err = parseInt("comments", t.Comments)
+	check("comments", err)
+	values.TimesCompleted, err = parseInt("times_completed", t.TimesCompleted)
+	check("times_completed", err)
+	values.Size, err = parseSize(t.Size)
+	check("size", err)
+	if len(t.IsVerified) != 0 {
+		values.IsVerified, err = strconv.ParseBool(t.IsVerified)
+		if err != nil {
+			values.IsVerified = false
+			err = fmt.Errorf("invalid isVerified %q", t.IsVerified)
+		}
+		check("isVerified", err)
+	}
+	if len(t.Added) != 0 {
+		values.Added, err = time.Parse("2006-01-02 15:04:05", t.Added)
+		if err != nil {
+			values.Added = time.Time{}
+			err = fmt.Errorf("invalid added date %q", t.Added)
+		}
+		check("added", err)
+	}
+	t.Values = values
+	t.InvalidFields = nil
+	if len(invalid) != 0 {
+		t.InvalidFields = invalid
+	}
+	return errors.Join(errs...)
+}
+
+// values returns the typed values of the torrent and the fields that could not
+// be parsed, see ParseValues. The raw fields are parsed when Values is unset,
+// as for torrents built by hand, so that all the checks and scores of the client
+// work on the same values.
+func (t *Torrent) values() (TorrentValues, []string) {
+	if t.Values != (TorrentValues{}) {
+		return t.Values, t.InvalidFields
+	}
+	parsed := Torrent{
+		Seeders:        t.Seeders,
+		Leechers:       t.Leechers,
+		Comments:       t.Comments,
+		TimesCompleted: t.TimesCompleted,
+		Size:           t.Size,
+		IsVerified:     t.IsVerified,
+		Added:          t.Added,
+	}
+	parsed.ParseValues()
+	return parsed.Values, parsed.InvalidFields
+}
+
+// seeders returns the number of seeders of the torrent
+// and whether it is valid, see values.
+func (t *Torrent) seeders() (int, bool) {
+	values, invalid := t.values()
+	return values.Seeders, !containsString(invalid, "seeders")
+}
+
+// size returns the size of the torrent content in bytes, see values.
+func (t *Torrent) size() (int64, error) {
+	values, invalid := t.values()
+	if containsString(invalid, "size") {
+		_, err := parseSize(t.Size)
+		return 0, err
+	}
+	return values.Size, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
 
 func (t *Torrent) checkTorrentName(title string) bool {
@@ -59,6 +278,53 @@ type Torrents struct {
 	Offset   string    `json:"offset"`
 	Limit    string    `json:"limit"`
 	Torrents []Torrent `json:"torrents"`
+	// Dropped is the number of entries of the torrents list returned by the API
+	// that were not torrents, not being objects or having no id, and were skipped.
+	Dropped int `json:"-"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+// The query, total, offset and limit fields can be encoded as JSON strings or numbers
+// and the elements of the torrents list that are not JSON objects or have no id
+// are dropped, since the API sometimes inserts integers in it. The torrents with
+// invalid fields are kept, see Torrent.InvalidFields.
+func (t *Torrents) UnmarshalJSON(data []byte) error {
+	raw := struct {
+		Query    rawString       `json:"query"`
+		Total    rawString       `json:"total"`
+		Offset   rawString       `json:"offset"`
+		Limit    rawString       `json:"limit"`
+		Torrents json.RawMessage `json:"torrents"`
+	}{}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	torrents := []Torrent{}
+	dropped, err := decodeObjectList(raw.Torrents, func(element json.RawMessage) error {
+		torrent := Torrent{}
+		err := json.Unmarshal(element, &torrent)
+		if err != nil {
+			return err
+		}
+		if len(torrent.ID) == 0 {
+			return fmt.Errorf("torrent without id")
+		}
+		torrents = append(torrents, torrent)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	*t = Torrents{
+		Query:    string(raw.Query),
+		Total:    string(raw.Total),
+		Offset:   string(raw.Offset),
+		Limit:    string(raw.Limit),
+		Torrents: torrents,
+		Dropped:  dropped,
+	}
+	return nil
 }
 
 func (t *Torrent) String() string {
@@ -74,11 +340,21 @@ type bySeeder struct {
 	torrentsList
 }
 
-// Less implements the sort.Interface
+// Less implements the sort.Interface, torrents with
+// an invalid number of seeders coming first.
 func (s bySeeder) Less(i, j int) bool {
-	seederI, _ := strconv.Atoi(s.torrentsList[i].Seeders)
-	seederJ, _ := strconv.Atoi(s.torrentsList[j].Seeders)
-	return seederI < seederJ
+	return lessSeeders(&s.torrentsList[i], &s.torrentsList[j])
+}
+
+// lessSeeders reports whether 'a' has fewer seeders than 'b',
+// an invalid number of seeders being less than any valid one.
+func lessSeeders(a, b *Torrent) bool {
+	seedersA, validA := a.seeders()
+	seedersB, validB := b.seeders()
+	if validA != validB {
+		return !validA
+	}
+	return seedersA < seedersB
 }
 
 // Len implements the sort.Interface
@@ -164,60 +440,7 @@ func init() {
 	temp := episodeNbrID[16]
 	episodeNbrID[16] = episodeNbrID[17]
 	episodeNbrID[17] = temp
-}
-
-func addEpisode(v url.Values, episode int) {
-	if episode >= 0 {
-		v.Add(fmt.Sprintf("term[%d][]", catEpisodeID), fmt.Sprintf("%d", episodeNbrID[episode]))
-	}
-}
-
-func addSeason(v url.Values, season int) {
-	if season >= 0 {
-		v.Add(fmt.Sprintf("term[%d][]", catSeasonID), fmt.Sprintf("%d", seasonNbrID[season]))
-	}
-}
-
-func addLanguage(v url.Values, language string) {
-	if ID, ok := LanguageMap[strings.ToLower(language)]; ok {
-		v.Add(fmt.Sprintf("term[%d][]", catLanguageID), fmt.Sprintf("%d", ID))
-	}
-}
-
-func addQuality(v url.Values, quality string) {
-	if ID, ok := QualityMap[quality]; ok {
-		v.Add(fmt.Sprintf("term[%d][]", catQualityID), fmt.Sprintf("%d", ID))
-	}
-}
-
-func addOffset(v url.Values, offset int) {
-	if offset >= 0 {
-		v.Add("offset", fmt.Sprintf("%d", offset))
-	}
-}
-
-func addLimit(v url.Values, limit int) {
-	if limit > 0 {
-		v.Add("limit", fmt.Sprintf("%d", limit))
-	}
-}
-
-// URL returns the url of the search request
-func (t *T411) makeURL(title string, season, episode int, language, quality string, offset, limit int) (string, *url.URL, error) {
-	usedAPI := "/torrents/search/"
-	u, err := url.Parse(fmt.Sprintf("%s%s%s", t.baseURL, usedAPI, title))
-	if err != nil {
-		return usedAPI, nil, err
-	}
-	v := u.Query()
-	addSeason(v, season)
-	addEpisode(v, episode)
-	addLanguage(v, language)
-	addQuality(v, quality)
-	addOffset(v, offset)
-	addLimit(v, limit)
-	u.RawQuery = v.Encode()
-	return usedAPI, u, nil
+	builtinTerms = newBuiltinTermMappings()
 }
 
 // SearchTorrentsByTerms searches a torrent using terms and return a list of torrents
@@ -228,45 +451,38 @@ func (t *T411) makeURL(title string, season, episode int, language, quality stri
 // 'season' available range is from 0 to 30 and 'episode' range is from 0 to 60.
 // The 'language' parameter must be one the values of the LanguageMap variable.
 // The 'quality' parameter must be one the values of the QualityMap variable.
+// See Search to search with several languages, qualities or any other terms.
 func (t *T411) SearchTorrentsByTerms(title string, season, episode int, language, quality string, offset, limit int) (*Torrents, error) {
-	usedAPI, u, err := t.makeURL(title, season, episode, language, quality, offset, limit)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := t.do("GET", u, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+	return t.SearchTorrentsByTermsContext(context.Background(), title, season, episode, language, quality, offset, limit)
+}
 
-	torrents := &Torrents{}
-	err = t.decode(torrents, resp, usedAPI, u.RawQuery)
-	if err != nil {
-		return nil, err
-	}
-	return torrents, nil
+// SearchTorrentsByTermsContext does the same as SearchTorrentsByTerms using the
+// provided context for the underlying http requests.
+func (t *T411) SearchTorrentsByTermsContext(ctx context.Context, title string, season, episode int, language, quality string, offset, limit int) (*Torrents, error) {
+	return t.SearchContext(ctx, termsQuery(t.termMappings(ctx), title, season, episode, language, quality, offset, limit))
 }
 
 // SearchAllTorrentByTerms does the same as SearchTorrentByTerms but get all the possible torrents
-// for the specific search in a single torrent slice.
+// for the specific search in a single torrent slice. They are fetched 100 at a time.
 func (t *T411) SearchAllTorrentByTerms(title string, season, episode int, language, quality string) (*Torrents, error) {
-	torrents, err := t.SearchTorrentsByTerms(title, season, episode, language, quality, 0, 100)
-	if err != nil {
-		return nil, err
-	}
-	total, err := strconv.Atoi(torrents.Total)
-	if err != nil {
-		return nil, err
-	}
-	if len(torrents.Torrents) == total {
-		return torrents, nil
-	}
+	return t.SearchAllTorrentByTermsContext(context.Background(), title, season, episode, language, quality)
+}
 
-	torrents, err = t.SearchTorrentsByTerms(title, season, episode, language, quality, 0, total)
+// SearchAllTorrentByTermsContext does the same as SearchAllTorrentByTerms using the
+// provided context for the underlying http requests.
+func (t *T411) SearchAllTorrentByTermsContext(ctx context.Context, title string, season, episode int, language, quality string) (*Torrents, error) {
+	it := t.IterateContext(ctx, termsQuery(t.termMappings(ctx), title, season, episode, language, quality, 0, 0), defaultPageSize)
+	list, err := it.All()
 	if err != nil {
 		return nil, err
 	}
-	return torrents, nil
+	return &Torrents{
+		Query:    title,
+		Total:    strconv.Itoa(len(list)),
+		Offset:   "0",
+		Limit:    strconv.Itoa(len(list)),
+		Torrents: list,
+	}, nil
 }
 
 // TorrentDetails represents the torrent detail data.
@@ -284,184 +500,243 @@ type TorrentDetails struct {
 	Terms         map[string]string `json:"terms"`
 }
 
+// UnmarshalJSON implements the json.Unmarshaler interface.
+// The id, category and owner fields can be encoded as JSON strings or numbers.
+func (d *TorrentDetails) UnmarshalJSON(data []byte) error {
+	type details TorrentDetails
+	raw := struct {
+		*details
+		ID       rawString `json:"id"`
+		Category rawString `json:"category"`
+		Owner    rawString `json:"owner"`
+	}{
+		details: (*details)(d),
+	}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	d.ID = string(raw.ID)
+	d.Category = string(raw.Category)
+	d.Owner = string(raw.Owner)
+	return nil
+}
+
 // TorrentsDetails returns the details of a torrent from a torrent 'id'.
 func (t *T411) TorrentsDetails(id string) (*TorrentDetails, error) {
+	return t.TorrentsDetailsContext(context.Background(), id)
+}
+
+// TorrentsDetailsContext does the same as TorrentsDetails using the
+// provided context for the underlying http requests.
+func (t *T411) TorrentsDetailsContext(ctx context.Context, id string) (*TorrentDetails, error) {
 	usedAPI := "/torrents/details/"
-	u, err := url.Parse(fmt.Sprintf("%s%s%s", t.baseURL, usedAPI, id))
+	u, err := url.Parse(fmt.Sprintf("%s%s%s", t.getBaseURL(), usedAPI, id))
 	if err != nil {
 		return nil, err
 	}
-	resp, err := t.do("GET", u, nil)
+	resp, err := t.do(ctx, "GET", u, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	details := &TorrentDetails{}
-	err = t.decode(details, resp, usedAPI, u.RawQuery)
+	err = t.decode(ctx, details, resp, usedAPI, u.RawQuery)
 	if err != nil {
 		return nil, err
 	}
 	return details, nil
 }
 
-// SortBySeeders sorts the given torrents by seeders.
+// SortBySeeders sorts the given torrents by increasing number of seeders,
+// using their typed Values or parsing their raw fields if Values is unset.
+// Torrents whose number of seeders cannot be parsed come first.
 func (*T411) SortBySeeders(torrents []Torrent) {
 	sort.Sort(bySeeder{torrents})
 }
 
-func (t *T411) checkRatio(torrent *Torrent) error {
-	if t.keepRatio && len(torrent.Size) != 0 {
-		torrentSize, err := strconv.ParseFloat(torrent.Size, 64)
-		if err != nil {
-			return err
-		}
-		ratio, err := t.GetOwnRatio(torrentSize)
+func (t *T411) checkRatio(ctx context.Context, torrent *Torrent) error {
+	if !t.isKeepingRatio() {
+		return nil
+	}
+	size, err := torrent.size()
+	if err != nil {
+		return err
+	}
+	if size != 0 {
+		ratio, err := t.GetOwnRatioContext(ctx, float64(size))
 		if err != nil {
 			return err
 		}
 		if ratio < 1 {
-			return fmt.Errorf("cannot download to keep ratio > 1")
+			return ErrKeepRatio
 		}
 	}
 	return nil
 }
 
 func (t *T411) checkVerified(torrent *Torrent) error {
-	if t.onlyVerified && torrent.IsVerified == "false" {
-		return fmt.Errorf("cannot download non-verified torrent")
+	// torrents with an unknown verification state are not refused
+	if t.isOnlyVerified() && len(torrent.IsVerified) != 0 {
+		verified, err := strconv.ParseBool(torrent.IsVerified)
+		if err != nil || !verified {
+			return ErrNotVerified
+		}
 	}
 	return nil
 }
 
 // DownloadTorrent downloads the torrent into a temporary
 // folder on success and returns the absolute path to the newly created file.
+// See DownloadTorrentTo and DownloadTorrentToDir to choose the destination.
 func (t *T411) DownloadTorrent(torrent *Torrent) (string, error) {
-	if err := t.checkRatio(torrent); err != nil {
-		return "", fmt.Errorf("cannot download to keep ratio > 1")
+	return t.DownloadTorrentContext(context.Background(), torrent)
+}
+
+// DownloadTorrentContext does the same as DownloadTorrent using the
+// provided context for the underlying http requests.
+func (t *T411) DownloadTorrentContext(ctx context.Context, torrent *Torrent) (string, error) {
+	info, err := t.DownloadTorrentToDir(ctx, torrent, os.TempDir())
+	if err != nil {
+		return "", err
+	}
+	return info.Path, nil
+}
+
+// downloadTorrent downloads the torrent file and returns its filename,
+// its content and its parsed metainfo.
+func (t *T411) downloadTorrent(ctx context.Context, torrent *Torrent) (string, []byte, *Metainfo, error) {
+	if err := t.checkRatio(ctx, torrent); err != nil {
+		return "", nil, nil, err
 	}
 	if err := t.checkVerified(torrent); err != nil {
-		return "", fmt.Errorf("cannot download non-verified torrent")
+		return "", nil, nil, err
 	}
-	u, err := url.Parse(fmt.Sprintf("%s/torrents/download/%s", t.baseURL, torrent.ID))
+	usedAPI := "/torrents/download/"
+	u, err := url.Parse(fmt.Sprintf("%s%s%s", t.getBaseURL(), usedAPI, torrent.ID))
 	if err != nil {
-		return "", err
+		return "", nil, nil, err
 	}
 
-	resp, err := t.do("GET", u, nil)
+	resp, err := t.do(ctx, "GET", u, nil)
 	if err != nil {
-		return "", err
+		return "", nil, nil, err
 	}
 	defer resp.Body.Close()
 
-	bytes, err := decodeErr(resp)
+	resp, bytes, err := t.readResponse(ctx, resp, usedAPI)
 	if err != nil {
-		return "", err
-	}
-	contentDisposition := resp.Header["Content-Disposition"]
-	if len(contentDisposition) == 0 {
-		return "", fmt.Errorf("'Content-Disposition' header not found in http response")
+		return "", nil, nil, err
 	}
-	split := strings.Split(contentDisposition[0], "\"")
-	if len(split) != 3 {
-		return "", fmt.Errorf("failed to extract filename from http 'Content-Disposition' header")
+	metainfo, err := ParseMetainfo(bytes)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("torrent %s: %w", torrent.ID, err)
 	}
-	filename := filepath.Join(os.TempDir(), split[1])
-	err = ioutil.WriteFile(filename, bytes, 0666)
+	t.metainfos.add(torrent.ID, metainfo)
+	filename, err := parseContentDisposition(resp.Header.Get("Content-Disposition"))
 	if err != nil {
-		return "", err
+		filename = fallbackFilename(torrent.ID)
+		t.logger.Printf("Using '%s' as torrent filename: %v", filename, err)
 	}
-	return filename, nil
+	return filename, bytes, metainfo, nil
 }
 
-func (t *T411) filterByPart(torrents []Torrent) ([]Torrent, error) {
-	filtered := []Torrent{}
-	for _, v := range torrents {
-		if !strings.Contains(strings.ToLower(v.Name), ".part.") {
-			filtered = append(filtered, v)
-		}
+// torrentFilter is a step of DownloadTorrentByTerms rejecting torrents.
+// reject returns why the torrent is rejected, an empty string if it is kept.
+type torrentFilter struct {
+	name   string
+	reject func(torrent *Torrent) string
+}
+
+func (t *T411) filterByPart() torrentFilter {
+	return torrentFilter{
+		name: PartFilter,
+		reject: func(torrent *Torrent) string {
+			if strings.Contains(strings.ToLower(torrent.Name), ".part.") {
+				return "name contains '.part.'"
+			}
+			return ""
+		},
+	}
+}
+
+// filterByVerified rejects the torrents DownloadTorrent would refuse to
+// download since they are not verified, see OnlyVerified.
+func (t *T411) filterByVerified() torrentFilter {
+	return torrentFilter{
+		name: VerifiedFilter,
+		reject: func(torrent *Torrent) string {
+			if err := t.checkVerified(torrent); err != nil {
+				return err.Error()
+			}
+			return ""
+		},
 	}
-	return filtered, nil
 }
 
-func (t *T411) filterByDate(torrents []Torrent, date string) ([]Torrent, error) {
+func (t *T411) filterByDate(date string) (torrentFilter, error) {
 	timeConstraint, err := time.Parse("2006-01-02", date)
 	if err != nil {
-		return nil, err
-	}
-	filtered := []Torrent{}
-	for _, v := range torrents {
-		timeAdded, err := time.Parse("2006-01-02 15:04:05", v.Added)
-		if err != nil {
-			return nil, err
-		}
-		diff := timeAdded.Sub(timeConstraint).Hours()
-		// 2 weeks close
-		if diff >= 0 && diff <= t.maxDelay {
-			filtered = append(filtered, v)
-		}
-	}
-	return filtered, nil
+		return torrentFilter{}, err
+	}
+	maxDelay := t.GetMaxDelay()
+	return torrentFilter{
+		name: DateFilter,
+		reject: func(torrent *Torrent) string {
+			// torrents without any added date cannot be close to the date
+			if torrent.Values.Added.IsZero() {
+				return "no added date"
+			}
+			diff := torrent.Values.Added.Sub(timeConstraint).Hours()
+			// 2 weeks close
+			if diff < 0 || diff > maxDelay {
+				return fmt.Sprintf("added on %s, not within %gh after %s",
+					torrent.Values.Added.Format("2006-01-02 15:04:05"), maxDelay, date)
+			}
+			return ""
+		},
+	}, nil
 }
 
-func (t *T411) filterByName(torrents []Torrent, title string) ([]Torrent, error) {
+func (t *T411) filterByName(title string) torrentFilter {
 	title = strings.ToLower(title)
 	title = strings.Replace(title, "(", " ", -1)
 	title = strings.Replace(title, ")", " ", -1)
 	words := strings.Split(title, " ")
-	filtered := []Torrent{}
-	for _, v := range torrents {
-		lowerName := strings.ToLower(v.Name)
-		containsAll := true
-		for _, v := range words {
-			if !strings.Contains(lowerName, v) {
-				containsAll = false
-				break
+	return torrentFilter{
+		name: NameFilter,
+		reject: func(torrent *Torrent) string {
+			lowerName := strings.ToLower(torrent.Name)
+			for _, v := range words {
+				if !strings.Contains(lowerName, v) {
+					return fmt.Sprintf("name does not contain '%s'", v)
+				}
 			}
-		}
-		if containsAll {
-			filtered = append(filtered, v)
-		}
+			return ""
+		},
 	}
-	return filtered, nil
 }
 
 // DownloadTorrentByTerms searches the torrent corresponding to the title,
-// season, episode and language, downloads the one with the most seeders
-// and return the location of the file located in a temporary folder.
+// season, episode and language, downloads the best one according to the ranker
+// set with WithRanker, the one with the most seeders by default, and return the
+// location of the file located in a temporary folder.
 // It also filters the torrents by a date in order to get torrents
 // with a date close to the provided one, if any.
 // Note: the search is done with an offset of 0 and a limit of 10 results per search by default.
 // Note: the 'language' parameter must be one of the values of LanguageMap variable.
 // Note: the 'quality' parameter must be one of the values of QualityMap variable.
 func (t *T411) DownloadTorrentByTerms(title string, season, episode int, language, quality, date string) (string, error) {
-	torrents, err := t.SearchTorrentsByTerms(title, season, episode, language, quality, 0, 0)
-	if err != nil {
-		return "", err
-	}
-	torrentList := torrents.Torrents
-	// filter by name first since pending torrents can have
-	// field Name empty so we check that first.
-	torrentList, err = t.filterByName(torrentList, title)
+	return t.DownloadTorrentByTermsContext(context.Background(), title, season, episode, language, quality, date)
+}
+
+// DownloadTorrentByTermsContext does the same as DownloadTorrentByTerms using the
+// provided context for the underlying http requests.
+func (t *T411) DownloadTorrentByTermsContext(ctx context.Context, title string, season, episode int, language, quality, date string) (string, error) {
+	selection, err := t.DownloadTorrentByTermsRankedContext(ctx, title, season, episode, language, quality, date)
 	if err != nil {
 		return "", err
 	}
-	if len(date) != 0 {
-		torrentList, err = t.filterByDate(torrentList, date)
-		if err != nil {
-			return "", err
-		}
-	}
-	if season != 0 && episode == 0 {
-		torrentList, err = t.filterByPart(torrentList)
-		if err != nil {
-			return "", err
-		}
-	}
-	if len(torrentList) == 0 {
-		return "", ErrTorrentNotFound
-	}
-	t.SortBySeeders(torrentList)
-	torrent := torrentList[len(torrentList)-1]
-	return t.DownloadTorrent(&torrent)
+	return selection.Path, nil
 }
@@ -1,6 +1,8 @@
 package t411client
 
 import (
+	"context"
+	"encoding/json"
 	"path/filepath"
 	"strings"
 
@@ -9,42 +11,45 @@ import (
 	"os"
 
 	"math"
+	"time"
 
+	"github.com/dns-gh/t411-client/t411client/t411test"
 	. "gopkg.in/check.v1"
 )
 
 func (s *MySuite) TestMakeURL(c *C) {
-	usedAPI, u, err := makeURL("breaking bad", 1, 1, "", "", 0, 0)
+	t411 := newEmptyClient("", "", "")
+	usedAPI, u, err := t411.makeURL(termsQuery(builtinTerms, "breaking bad", 1, 1, "", "", 0, 0))
 	c.Assert(err, IsNil)
 	c.Assert(usedAPI, Equals, "/torrents/search/")
 	expected := t411BaseURL + "/torrents/search/breaking%20bad?offset=0&term%5B45%5D%5B%5D=968&term%5B46%5D%5B%5D=937"
 	c.Assert(u.String(), Equals, expected)
 
-	usedAPI, u, err = makeURL("breaking bad", 1, 1, "", "", 1, 1)
+	usedAPI, u, err = t411.makeURL(termsQuery(builtinTerms, "breaking bad", 1, 1, "", "", 1, 1))
 	c.Assert(err, IsNil)
 	c.Assert(usedAPI, Equals, "/torrents/search/")
 	expected = t411BaseURL + "/torrents/search/breaking%20bad?limit=1&offset=1&term%5B45%5D%5B%5D=968&term%5B46%5D%5B%5D=937"
 	c.Assert(u.String(), Equals, expected)
 
-	usedAPI, u, err = makeURL("vikings", 1, 1, "", "", 0, 0)
+	usedAPI, u, err = t411.makeURL(termsQuery(builtinTerms, "vikings", 1, 1, "", "", 0, 0))
 	c.Assert(err, IsNil)
 	c.Assert(usedAPI, Equals, "/torrents/search/")
 	expected = t411BaseURL + "/torrents/search/vikings?offset=0&term%5B45%5D%5B%5D=968&term%5B46%5D%5B%5D=937"
 	c.Assert(u.String(), Equals, expected)
 
-	usedAPI, u, err = makeURL("vikings", 2, 3, "", "", 0, 0)
+	usedAPI, u, err = t411.makeURL(termsQuery(builtinTerms, "vikings", 2, 3, "", "", 0, 0))
 	c.Assert(err, IsNil)
 	c.Assert(usedAPI, Equals, "/torrents/search/")
 	expected = t411BaseURL + "/torrents/search/vikings?offset=0&term%5B45%5D%5B%5D=969&term%5B46%5D%5B%5D=939"
 	c.Assert(u.String(), Equals, expected)
 
-	usedAPI, u, err = makeURL("vikings", 2, 3, "english", "", 0, 0)
+	usedAPI, u, err = t411.makeURL(termsQuery(builtinTerms, "vikings", 2, 3, "english", "", 0, 0))
 	c.Assert(err, IsNil)
 	c.Assert(usedAPI, Equals, "/torrents/search/")
 	expected = t411BaseURL + "/torrents/search/vikings?offset=0&term%5B45%5D%5B%5D=969&term%5B46%5D%5B%5D=939&term%5B51%5D%5B%5D=1209"
 	c.Assert(u.String(), Equals, expected)
 
-	usedAPI, u, err = makeURL("vikings", 2, 3, "english", "DVDrip [Rip depuis DVD-R]", 0, 0)
+	usedAPI, u, err = t411.makeURL(termsQuery(builtinTerms, "vikings", 2, 3, "english", "DVDrip [Rip depuis DVD-R]", 0, 0))
 	c.Assert(err, IsNil)
 	c.Assert(usedAPI, Equals, "/torrents/search/")
 	expected = t411BaseURL + "/torrents/search/vikings?offset=0&term%5B45%5D%5B%5D=969&term%5B46%5D%5B%5D=939&term%5B51%5D%5B%5D=1209&term%5B7%5D%5B%5D=10"
@@ -63,7 +68,7 @@ func checkTorrents(c *C, torrents *Torrents, query string, offset, limit int) {
 }
 
 func (s *MySuite) TestSearchTorrentsByTerms(c *C) {
-	t411, _, _ := createT411Client(c)
+	t411, _, _ := s.createT411Client(c)
 	torrents, err := t411.SearchTorrentsByTerms("vikings", 1, 1, "", "", 0, 0)
 	c.Assert(err, IsNil)
 	checkTorrents(c, torrents, "viking", 0, 10)
@@ -93,8 +98,23 @@ func (s *MySuite) TestSearchTorrentsByTerms(c *C) {
 	checkTorrents(c, torrents, "avatar", 0, 10)
 }
 
+func (s *MySuite) TestSearchTorrentsByTermsContext(c *C) {
+	t411, _, _ := s.createT411Client(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	torrents, err := t411.SearchTorrentsByTermsContext(ctx, "vikings", 1, 1, "", "", 0, 0)
+	c.Assert(err, IsNil)
+	checkTorrents(c, torrents, "viking", 0, 10)
+
+	cancel()
+	_, err = t411.SearchTorrentsByTermsContext(ctx, "vikings", 1, 1, "", "", 0, 0)
+	c.Assert(err, ErrorMatches, ".*context canceled")
+	_, err = t411.DownloadTorrentByTermsContext(ctx, "vikings", 1, 1, "", "", "")
+	c.Assert(err, ErrorMatches, ".*context canceled")
+	c.Assert(s.server.Hits(t411test.TorrentsSearchAPI), Equals, 1)
+}
+
 func (s *MySuite) TestSearchAllTorrents(c *C) {
-	t411, _, _ := createT411Client(c)
+	t411, _, _ := s.createT411Client(c)
 	torrents, err := t411.SearchAllTorrentByTerms("vikings", -1, -1, "", "")
 	c.Assert(err, IsNil)
 	c.Assert(torrents.Total, Equals, strconv.Itoa(len(torrents.Torrents)))
@@ -105,7 +125,7 @@ func (s *MySuite) TestSearchAllTorrents(c *C) {
 }
 
 func (s *MySuite) TestSearchTorrentsByTermsComplete(c *C) {
-	t411, _, _ := createT411Client(c)
+	t411, _, _ := s.createT411Client(c)
 	torrents, err := t411.SearchTorrentsByTerms("stargate", 1, 0, "", "", 0, 0)
 	c.Assert(err, IsNil)
 	seasonComplete := false
@@ -130,7 +150,7 @@ func (s *MySuite) TestSearchTorrentsByTermsComplete(c *C) {
 }
 
 func (s *MySuite) TestSearchTorrentsSortingBySeeders(c *C) {
-	t411, _, _ := createT411Client(c)
+	t411, _, _ := s.createT411Client(c)
 	torrents, err := t411.SearchTorrentsByTerms("vikings", 1, 1, "", "", 0, 0)
 	c.Assert(err, IsNil)
 	checkTorrents(c, torrents, "viking", 0, 10)
@@ -144,10 +164,26 @@ func (s *MySuite) TestSearchTorrentsSortingBySeeders(c *C) {
 		c.Assert(current <= temp, Equals, true)
 		current = temp
 	}
+
+	// torrents built by hand are sorted by their raw seeders,
+	// invalid ones coming first rather than as zero seeders
+	handmade := []Torrent{
+		{ID: "1", Seeders: "12"},
+		{ID: "2", Seeders: "3"},
+		{ID: "3", Values: TorrentValues{Seeders: 7}},
+		{ID: "4", Seeders: "many"},
+		{ID: "5", Seeders: "0"},
+	}
+	t411.SortBySeeders(handmade)
+	IDs := []string{}
+	for _, torrent := range handmade {
+		IDs = append(IDs, torrent.ID)
+	}
+	c.Assert(IDs, DeepEquals, []string{"4", "5", "2", "3", "1"})
 }
 
 func (s *MySuite) TestDownloadTorrent(c *C) {
-	t411, _, _ := createT411Client(c)
+	t411, _, _ := s.createT411Client(c)
 	torrents, err := t411.SearchTorrentsByTerms("vikings", 1, 1, "", "", 0, 0)
 	c.Assert(err, IsNil)
 	torrentsList := torrents.Torrents
@@ -158,36 +194,39 @@ func (s *MySuite) TestDownloadTorrent(c *C) {
 		c.Assert(os.Remove(path), IsNil)
 	}()
 	c.Assert(strings.Contains(path, "tmp"), Equals, true)
-	c.Assert(filepath.Base(path), Equals, "Vikings.S01E01.REPACK.HDTV.x264-2HD.torrent")
+	c.Assert(filepath.Base(path), Equals, "Vikings.S01E01.HDTV.x264.2HD.VOSTFR.torrent")
 
 	torrentsList[0].IsVerified = "false"
 	t411.OnlyVerified(true)
 	_, err = t411.DownloadTorrent(&torrentsList[0])
-	c.Assert(err.Error(), DeepEquals, "cannot download non-verified torrent")
+	c.Assert(err, ErrorIs, ErrNotVerified)
 
 	_, err = t411.DownloadTorrent(&Torrent{
 		ID:   "123456789",
 		Size: "",
 	})
-	c.Assert(err, DeepEquals, ErrTorrentNotFound)
+	c.Assert(err, ErrorIs, ErrTorrentNotFound)
 
 	maxFloat := strconv.FormatFloat(math.MaxFloat64, 'E', -1, 64)
-	_, err = t411.DownloadTorrent(&Torrent{
+	torrent := &Torrent{
 		ID:   "123456789",
 		Size: maxFloat,
-	})
-	c.Assert(err.Error(), DeepEquals, "cannot download to keep ratio > 1")
-
-	t411.KeepRatio(false)
+	}
+	_, err = t411.DownloadTorrent(torrent)
+	c.Assert(err, ErrorIs, ErrKeepRatio)
 	_, err = t411.DownloadTorrent(&Torrent{
 		ID:   "123456789",
-		Size: maxFloat,
+		Size: "big",
 	})
-	c.Assert(err, DeepEquals, ErrTorrentNotFound)
+	c.Assert(err, ErrorMatches, `invalid size "big"`)
+
+	t411.KeepRatio(false)
+	_, err = t411.DownloadTorrent(torrent)
+	c.Assert(err, ErrorIs, ErrTorrentNotFound)
 }
 
 func (s *MySuite) TestDownloadTorrentByTerms(c *C) {
-	t411, _, _ := createT411Client(c)
+	t411, _, _ := s.createT411Client(c)
 	path, err := t411.DownloadTorrentByTerms("vikings", 1, 1, "", "", "")
 	c.Assert(err, IsNil)
 	defer func() {
@@ -197,11 +236,18 @@ func (s *MySuite) TestDownloadTorrentByTerms(c *C) {
 	c.Assert(strings.Contains(path, "Vikings.S01E01"), Equals, true)
 
 	_, err = t411.DownloadTorrentByTerms("vikings", 100, 100, "", "", "")
-	c.Assert(err, DeepEquals, ErrTorrentNotFound)
+	c.Assert(err, ErrorIs, ErrTorrentNotFound)
+
+	t411.SetMaxDelay(24 * 7)
+	other, err := t411.DownloadTorrentByTerms("vikings", 1, 1, "", "", "2013-03-01")
+	c.Assert(err, IsNil)
+	c.Assert(other, Equals, path)
+	_, err = t411.DownloadTorrentByTerms("vikings", 1, 1, "", "", "2013-02-01")
+	c.Assert(err, ErrorIs, ErrTorrentNotFound)
 }
 
 func (s *MySuite) TestTorrentsDetails(c *C) {
-	t411, _, _ := createT411Client(c)
+	t411, _, _ := s.createT411Client(c)
 	torrents, err := t411.SearchTorrentsByTerms("vikings", 1, 1, "", "", 0, 0)
 	c.Assert(err, IsNil)
 	torrentsList := torrents.Torrents
@@ -234,5 +280,129 @@ func (s *MySuite) TestTorrentsDetails(c *C) {
 	c.Assert(details, DeepEquals, expected)
 
 	_, err = t411.TorrentsDetails("1")
-	c.Assert(err, DeepEquals, err301TorrentNotFound)
+	c.Assert(err, ErrorIs, err301TorrentNotFound)
+}
+
+func (s *MySuite) TestTorrentUnmarshalJSON(c *C) {
+	torrent := Torrent{}
+	err := json.Unmarshal([]byte(`{"id":123,"name":"Vikings.S01E01","seeders":"12","leechers":3,`+
+		`"comments":null,"isVerified":"1","added":"2013-03-04 10:00:00","size":367001600,"times_completed":"7","owner":0}`), &torrent)
+	c.Assert(err, IsNil)
+	c.Assert(torrent.ID, Equals, "123")
+	c.Assert(torrent.Leechers, Equals, "3")
+	c.Assert(torrent.Size, Equals, "367001600")
+	c.Assert(torrent.Owner, Equals, "0")
+	c.Assert(torrent.Values, DeepEquals, TorrentValues{
+		Seeders:        12,
+		Leechers:       3,
+		TimesCompleted: 7,
+		Size:           367001600,
+		IsVerified:     true,
+		Added:          time.Date(2013, 3, 4, 10, 0, 0, 0, time.UTC),
+	})
+
+	err = json.Unmarshal([]byte(`{"id":"1","isVerified":false}`), &torrent)
+	c.Assert(err, IsNil)
+	c.Assert(torrent.IsVerified, Equals, "false")
+	c.Assert(torrent.Values, DeepEquals, TorrentValues{})
+
+	c.Assert(torrent.InvalidFields, IsNil)
+
+	// the fields that cannot be parsed do not fail the torrent
+	err = json.Unmarshal([]byte(`{"id":"1","seeders":"many","leechers":"2","size":"big",`+
+		`"added":"0000-00-00 00:00:00","times_completed":"n/a","isVerified":"1"}`), &torrent)
+	c.Assert(err, IsNil)
+	c.Assert(torrent.Seeders, Equals, "many")
+	c.Assert(torrent.Added, Equals, "0000-00-00 00:00:00")
+	c.Assert(torrent.Values, DeepEquals, TorrentValues{
+		Leechers:   2,
+		IsVerified: true,
+	})
+	c.Assert(torrent.InvalidFields, DeepEquals, []string{"seeders", "times_completed", "size", "added"})
+	err = torrent.ParseValues()
+	c.Assert(err, ErrorMatches, `invalid seeders "many"\ninvalid times_completed "n/a"\n`+
+		`invalid size "big"\ninvalid added date "0000-00-00 00:00:00"`)
+	torrent.Seeders = "12"
+	c.Assert(torrent.ParseValues(), NotNil)
+	c.Assert(torrent.Values.Seeders, Equals, 12)
+	c.Assert(torrent.InvalidFields, HasLen, 3)
+	err = json.Unmarshal([]byte(`{"id":["1"]}`), &torrent)
+	c.Assert(err, NotNil)
+}
+
+func (s *MySuite) TestTorrentsUnmarshalJSON(c *C) {
+	torrents := Torrents{}
+	err := json.Unmarshal([]byte(`{"query":"vikings","total":"4","offset":5,"limit":25,`+
+		`"torrents":[12,{"id":"1"},34,56,{"id":"2","seeders":"many"},{"id":"3","name":["x"]},"junk",[1],{"id":4},78,`+
+		`{"name":"no id"},{"id":null},{"id":{}}]}`), &torrents)
+	c.Assert(err, IsNil)
+	c.Assert(torrents.Query, Equals, "vikings")
+	c.Assert(torrents.Total, Equals, "4")
+	c.Assert(torrents.Offset, Equals, "5")
+	c.Assert(torrents.Limit, Equals, "25")
+	c.Assert(torrents.Torrents, HasLen, 4)
+	c.Assert(torrents.Torrents[0].ID, Equals, "1")
+	c.Assert(torrents.Torrents[1].ID, Equals, "2")
+	c.Assert(torrents.Torrents[1].InvalidFields, DeepEquals, []string{"seeders"})
+	c.Assert(torrents.Torrents[2].ID, Equals, "3")
+	c.Assert(torrents.Torrents[2].InvalidFields, DeepEquals, []string{"name"})
+	c.Assert(torrents.Torrents[3].ID, Equals, "4")
+	c.Assert(torrents.Dropped, Equals, 9)
+
+	err = json.Unmarshal([]byte(`{"query":"vikings","total":0,"offset":0,"limit":10,"torrents":[]}`), &torrents)
+	c.Assert(err, IsNil)
+	c.Assert(torrents.Total, Equals, "0")
+	c.Assert(torrents.Torrents, HasLen, 0)
+	c.Assert(torrents.Dropped, Equals, 0)
+
+	err = json.Unmarshal([]byte(`{"torrents":{"id":"1"}}`), &torrents)
+	c.Assert(err, NotNil)
+	err = json.Unmarshal([]byte(`{"torrents":[{"id":"1"}`), &torrents)
+	c.Assert(err, NotNil)
+
+	details := TorrentDetails{}
+	err = json.Unmarshal([]byte(`{"id":4831500,"name":"Vikings","category":433,"owner":0,"terms":{"a":"b"}}`), &details)
+	c.Assert(err, IsNil)
+	c.Assert(details, DeepEquals, TorrentDetails{
+		ID:       "4831500",
+		Name:     "Vikings",
+		Category: "433",
+		Owner:    "0",
+		Terms:    map[string]string{"a": "b"},
+	})
+}
+
+func (s *MySuite) TestSearchTorrentsWithInvalidFields(c *C) {
+	s.server.AddTorrent(t411test.Torrent{ID: "6000000", Name: "Zero.Date.S01E01", Seeders: "4", Added: "0000-00-00 00:00:00", TermIDs: []int{968, 937}})
+	t411, _, _ := s.createT411Client(c)
+	torrents, err := t411.SearchTorrentsByTerms("zero date", 1, 1, "", "", 0, 0)
+	c.Assert(err, IsNil)
+	c.Assert(torrents.Dropped, Equals, 0)
+	c.Assert(torrents.Torrents, HasLen, 1)
+	c.Assert(torrents.Torrents[0].ID, Equals, "6000000")
+	c.Assert(torrents.Torrents[0].Added, Equals, "0000-00-00 00:00:00")
+	c.Assert(torrents.Torrents[0].Values.Added.IsZero(), Equals, true)
+	c.Assert(torrents.Torrents[0].Values.Seeders, Equals, 4)
+	c.Assert(torrents.Torrents[0].InvalidFields, DeepEquals, []string{"added"})
+
+	plan, err := t411.PlanDownload("zero date", 1, 1, "", "", "")
+	c.Assert(err, IsNil)
+	c.Assert(plan.Pick, NotNil)
+	c.Assert(plan.Pick.ID, Equals, "6000000")
+}
+
+func (s *MySuite) TestSearchTorrentsWithJunkEntries(c *C) {
+	t411, _, _ := s.createT411Client(c)
+	s.server.InjectJunkEntries(1, 2, 3)
+	torrents, err := t411.SearchTorrentsByTerms("vikings", 1, 1, "", "", 0, 25)
+	c.Assert(err, IsNil)
+	checkTorrents(c, torrents, "viking", 0, 25)
+	c.Assert(torrents.Torrents, HasLen, 12)
+	c.Assert(torrents.Dropped, Equals, 3)
+
+	torrents, err = t411.SearchTorrentsByTerms("vikings", 100, 100, "", "", 0, 0)
+	c.Assert(err, IsNil)
+	c.Assert(torrents.Total, Equals, "0")
+	c.Assert(torrents.Torrents, HasLen, 0)
+	c.Assert(torrents.Dropped, Equals, 3)
 }
@@ -1,6 +1,7 @@
 package t411client
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"net/url"
@@ -19,20 +20,26 @@ type User struct {
 
 // UsersProfile gets the user infos of the user with id 'uid'.
 func (t *T411) UsersProfile(uid string) (*User, error) {
+	return t.UsersProfileContext(context.Background(), uid)
+}
+
+// UsersProfileContext does the same as UsersProfile using the
+// provided context for the underlying http requests.
+func (t *T411) UsersProfileContext(ctx context.Context, uid string) (*User, error) {
 	usedAPI := "/users/profile"
-	u, err := url.Parse(fmt.Sprintf("%s%s/%s", t.baseURL, usedAPI, url.QueryEscape(uid)))
+	u, err := url.Parse(fmt.Sprintf("%s%s/%s", t.getBaseURL(), usedAPI, url.QueryEscape(uid)))
 	if err != nil {
-		return nil, ErrURLParsing
+		return nil, fmt.Errorf("%w: %s", ErrURLParsing, err)
 	}
 
-	resp, err := t.do("GET", u, nil)
+	resp, err := t.do(ctx, "GET", u, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	user := &User{}
-	err = t.decode(user, resp, usedAPI, u.RawQuery)
+	err = t.decode(ctx, user, resp, usedAPI, u.RawQuery)
 	if err != nil {
 		return nil, err
 	}
@@ -41,7 +48,13 @@ func (t *T411) UsersProfile(uid string) (*User, error) {
 
 // GetOwnProfile gets the profile of the authenticated user.
 func (t *T411) GetOwnProfile() (*User, error) {
-	return t.UsersProfile(t.token.UID)
+	return t.GetOwnProfileContext(context.Background())
+}
+
+// GetOwnProfileContext does the same as GetOwnProfile using the
+// provided context for the underlying http requests.
+func (t *T411) GetOwnProfileContext(ctx context.Context) (*User, error) {
+	return t.UsersProfileContext(ctx, t.getToken().UID)
 }
 
 // GetRatio returns the uploaded/(downloaded+incoming) ratio of the user.
@@ -63,7 +76,13 @@ func (u *User) GetRatio(incoming float64) (float64, error) {
 // GetOwnRatio returns the uploaded/(downloaded+incoming) ratio
 // of the authenticated user.
 func (t *T411) GetOwnRatio(incoming float64) (float64, error) {
-	user, err := t.GetOwnProfile()
+	return t.GetOwnRatioContext(context.Background(), incoming)
+}
+
+// GetOwnRatioContext does the same as GetOwnRatio using the
+// provided context for the underlying http requests.
+func (t *T411) GetOwnRatioContext(ctx context.Context, incoming float64) (float64, error) {
+	user, err := t.GetOwnProfileContext(ctx)
 	if err != nil {
 		return 0, err
 	}
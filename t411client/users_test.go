@@ -11,7 +11,7 @@ func checkUser(c *C, t411 *T411, username string) {
 }
 
 func (s *MySuite) TestUsersProfile(c *C) {
-	t411, username, _ := createT411Client(c)
+	t411, username, _ := s.createT411Client(c)
 	checkUser(c, t411, username)
 
 	user, err := t411.GetOwnProfile()